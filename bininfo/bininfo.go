@@ -2,6 +2,7 @@ package bininfo
 
 import (
 	"debug/elf"
+	"debug/gosym"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -12,11 +13,17 @@ import (
 )
 
 // Translator translates information about an executable.
+// PCs are link-time addresses. Use ProcessTranslator for PCs observed in a running process.
 type Translator interface {
-	// Address returns the address of the given symbol in the executable.
+	// Address returns the offset of the given symbol in the executable file to attach uprobes.
 	Address(symbol string) uint64
 	// Stack returns a stack trace from the given stack bytes.
 	PCToFunc(pc uint64) *proc.Function
+	// PCToFrames returns the logical frames of the given PC, innermost first.
+	// All frames but the last one are inlined into the next frame.
+	// The file is empty and the line is 0 if the line information is not available.
+	// It returns nil if no function is found for the PC.
+	PCToFrames(pc uint64) []Frame
 }
 
 // NewTranslator creates a new Translator for the given executable.
@@ -29,15 +36,23 @@ func NewTranslator(path string) (Translator, error) {
 		slog.Debug("failed to load binary info", slog.Any("error", err))
 	}
 	s, err := newSymbolTable(path)
+	if err == nil {
+		slog.Debug("loaded symbol table")
+		return s, nil
+	}
+	slog.Debug("failed to load symbol table", slog.Any("error", err))
+	t, err := newPclnTable(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load symbol table: %w", err)
+		return nil, fmt.Errorf("failed to load .gopclntab: %w", err)
 	}
-	slog.Debug("loaded symbol table")
-	return s, nil
+	slog.Debug("loaded .gopclntab")
+	return t, nil
 }
 
 type binaryInfo struct {
 	*proc.BinaryInfo
+	segments segments
+	inlines  *inlineTable // nil if the inlined calls are not available
 }
 
 func newBinInfo(path string) (*binaryInfo, error) {
@@ -45,8 +60,20 @@ func newBinInfo(path string) (*binaryInfo, error) {
 	if err := bininfo.LoadBinaryInfo(path, 0, nil); err != nil {
 		return nil, fmt.Errorf("failed to load binary info: %w", err)
 	}
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
 	var bi binaryInfo
 	bi.BinaryInfo = bininfo
+	bi.segments = newSegments(f)
+	inlines, err := newInlineTable(path)
+	if err != nil {
+		slog.Debug("failed to load inlined calls, so inlined frames are not expanded", slog.Any("error", err))
+	} else {
+		bi.inlines = inlines
+	}
 	return &bi, nil
 }
 
@@ -57,15 +84,28 @@ func (bi *binaryInfo) Address(symbol string) uint64 {
 	}
 	for _, f := range funcs {
 		if f.Name == symbol {
-			return f.Entry
+			return bi.segments.fileOffset(f.Entry)
 		}
 	}
 	return 0
 }
 
+func (bi *binaryInfo) PCToFrames(pc uint64) []Frame {
+	file, line, f := bi.PCToLine(pc)
+	if f == nil {
+		return nil
+	}
+	if bi.inlines == nil {
+		return []Frame{{Function: f.Name, File: file, Line: line}}
+	}
+	return bi.inlines.frames(pc, file, line, f)
+}
+
 type symbolTable struct {
-	addresses map[string]uint64
-	functions []*proc.Function
+	addresses  map[string]uint64
+	functions  []*proc.Function
+	goSymTable *gosym.Table    // nil if .gopclntab is not available
+	inlines    *pclnInlineTree // nil if the inline trees are not available
 }
 
 // Copy from https://github.com/cilium/ebpf/blob/v0.12.3/link/uprobe.go#L116-L160
@@ -74,6 +114,7 @@ func newSymbolTable(path string) (*symbolTable, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 	syms, err := f.Symbols()
 	if err != nil && !errors.Is(err, elf.ErrNoSymbols) {
 		return nil, err
@@ -86,37 +127,42 @@ func newSymbolTable(path string) (*symbolTable, error) {
 	if len(syms) == 0 {
 		return nil, elf.ErrNoSymbols
 	}
+	segments := newSegments(f)
 	addresses := make(map[string]uint64)
 	functions := make([]*proc.Function, 0, len(syms))
 	for _, s := range syms {
 		if elf.ST_TYPE(s.Info) != elf.STT_FUNC {
 			continue
 		}
-		address := s.Value
-		for _, prog := range f.Progs {
-			if prog.Type != elf.PT_LOAD || (prog.Flags&elf.PF_X) == 0 {
-				continue
-			}
-			if prog.Vaddr <= s.Value && s.Value < (prog.Vaddr+prog.Memsz) {
-				address = s.Value - prog.Vaddr + prog.Off
-				break
-			}
-		}
-		addresses[s.Name] = address
-		index := sort.Search(len(functions), func(i int) bool { return functions[i].Entry >= address })
+		addresses[s.Name] = segments.fileOffset(s.Value)
+		index := sort.Search(len(functions), func(i int) bool { return functions[i].Entry >= s.Value })
 		functions = append(functions, &proc.Function{})
 		copy(functions[index+1:], functions[index:])
 		functions[index] = &proc.Function{
 			Name:  s.Name,
-			Entry: address,
+			Entry: s.Value,
 		}
 	}
+	// A stripped executable that is dynamically linked, such as with cgo, and a stripped shared object
+	// still have the dynamic symbols, but not the functions of the Go runtime.
+	if _, ok := addresses["runtime.newproc1"]; !ok {
+		return nil, errors.New("no functions of the Go runtime in the symbol table")
+	}
 	for i := 0; i < len(functions)-1; i++ {
 		functions[i].End = functions[i+1].Entry
 	}
+	var inlines *pclnInlineTree
+	goSymTable, err := newGoSymTable(f)
+	if err != nil {
+		slog.Debug("failed to load .gopclntab, so file and line numbers are not available", slog.Any("error", err))
+	} else {
+		inlines = loadPclnInlineTree(path, f, goSymTable)
+	}
 	return &symbolTable{
-		addresses: addresses,
-		functions: functions,
+		addresses:  addresses,
+		functions:  functions,
+		goSymTable: goSymTable,
+		inlines:    inlines,
 	}, nil
 }
 
@@ -137,7 +183,7 @@ func (s *symbolTable) PCToFunc(pc uint64) *proc.Function {
 
 		if pc < f.Entry {
 			high = mid - 1
-		} else if pc > f.End {
+		} else if pc >= f.End {
 			low = mid + 1
 		} else {
 			return f
@@ -145,3 +191,23 @@ func (s *symbolTable) PCToFunc(pc uint64) *proc.Function {
 	}
 	return nil
 }
+
+func (s *symbolTable) PCToLine(pc uint64) (string, int, *proc.Function) {
+	f := s.PCToFunc(pc)
+	if s.goSymTable == nil {
+		return "", 0, f
+	}
+	file, line, _ := s.goSymTable.PCToLine(pc)
+	return file, line, f
+}
+
+func (s *symbolTable) PCToFrames(pc uint64) []Frame {
+	file, line, f := s.PCToLine(pc)
+	if f == nil {
+		return nil
+	}
+	if s.inlines == nil {
+		return []Frame{{Function: f.Name, File: file, Line: line}}
+	}
+	return s.inlines.frames(pc, file, line, f.Name)
+}
@@ -0,0 +1,104 @@
+package bininfo
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	noteTypeGNUBuildID = 3 // NT_GNU_BUILD_ID
+	noteTypeGoBuildID  = 4 // https://github.com/golang/go/blob/release-branch.go1.23/src/cmd/internal/buildid/note.go
+)
+
+// Executable returns the path to the executable that the process is running.
+// The path is resolved through /proc/<pid>/root since the process may run in another mount namespace, e.g. a container.
+func Executable(pid int) (string, error) {
+	procDir := filepath.Join("/proc", strconv.Itoa(pid))
+	exe, err := os.Readlink(filepath.Join(procDir, "exe"))
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(procDir, "root", exe)
+	if _, err := os.Stat(path); err != nil {
+		// The executable has been deleted or replaced after the process started,
+		// but /proc/<pid>/exe still refers to the file that the process is running.
+		return filepath.Join(procDir, "exe"), nil
+	}
+	return path, nil
+}
+
+// VerifyExecutable returns an error if path is not the executable that the process is running.
+// The executables are compared by the GNU build ID, or by the Go build ID if the GNU one is not available.
+func VerifyExecutable(path string, pid int) error {
+	exe, err := Executable(pid)
+	if err != nil {
+		return fmt.Errorf("failed to resolve the executable of pid %d: %w", pid, err)
+	}
+	want, err := BuildID(exe)
+	if err != nil {
+		return fmt.Errorf("failed to read the build ID of pid %d: %w", pid, err)
+	}
+	got, err := BuildID(path)
+	if err != nil {
+		return fmt.Errorf("failed to read the build ID of %s: %w", path, err)
+	}
+	if got != want {
+		return fmt.Errorf("%s is not the executable of pid %d: build ID %s, but pid %d runs %s with build ID %s", path, pid, got, pid, exe, want)
+	}
+	return nil
+}
+
+// BuildID returns the GNU build ID of the ELF file, or the Go build ID if the GNU one is not available.
+// The Go linker emits the GNU build ID only with -B or the external linker.
+func BuildID(path string) (string, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var goBuildID string
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_NOTE {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return "", err
+		}
+		for len(data) >= 12 {
+			nameSize := f.ByteOrder.Uint32(data[0:4])
+			descSize := f.ByteOrder.Uint32(data[4:8])
+			noteType := f.ByteOrder.Uint32(data[8:12])
+			data = data[12:]
+			nameEnd := align4(nameSize)
+			descEnd := nameEnd + align4(descSize)
+			if uint64(len(data)) < descEnd {
+				break
+			}
+			name := string(bytes.TrimRight(data[:nameSize], "\x00"))
+			desc := data[nameEnd : nameEnd+uint64(descSize)]
+			switch {
+			case name == "GNU" && noteType == noteTypeGNUBuildID:
+				return hex.EncodeToString(desc), nil
+			case name == "Go" && noteType == noteTypeGoBuildID:
+				goBuildID = strings.TrimRight(string(desc), "\x00")
+			}
+			data = data[descEnd:]
+		}
+	}
+	if goBuildID != "" {
+		return goBuildID, nil
+	}
+	return "", errors.New("no build ID")
+}
+
+func align4(n uint32) uint64 {
+	return (uint64(n) + 3) &^ 3
+}
@@ -0,0 +1,31 @@
+package bininfo
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_BuildID(t *testing.T) {
+	path, err := os.Executable()
+	require.NoError(t, err)
+	got, err := BuildID(path)
+	require.NoError(t, err)
+	assert.NotEmpty(t, got)
+
+	exe, err := Executable(os.Getpid())
+	require.NoError(t, err)
+	want, err := BuildID(exe)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+func Test_VerifyExecutable(t *testing.T) {
+	path, err := os.Executable()
+	require.NoError(t, err)
+	assert.NoError(t, VerifyExecutable(path, os.Getpid()))
+	// Any other executable has a different build ID.
+	assert.Error(t, VerifyExecutable("/bin/sh", os.Getpid()))
+}
@@ -0,0 +1,191 @@
+package bininfo
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	// gStatusDead is _Gdead. The g of an exited goroutine stays in runtime.allgs to be reused.
+	// https://github.com/golang/go/blob/release-branch.go1.23/src/runtime/runtime2.go#L95
+	gStatusDead = 6
+	// gStatusScan is _Gscan, which is combined with other statuses while the GC scans the stack.
+	gStatusScan = 0x1000
+	// maxGoroutines bounds the length of runtime.allgs read from a process in case it is being modified.
+	maxGoroutines = 1 << 22
+	// opAddr is DW_OP_addr.
+	opAddr = 0x03
+)
+
+// Goroutine is a goroutine read from the memory of a process.
+type Goroutine struct {
+	Id      int64
+	Gopc    uint64 // 0 if the offset of runtime.g.gopc is unknown
+	Startpc uint64 // 0 if the offset of runtime.g.startpc is unknown
+}
+
+// ReadGoroutines reads the live goroutines in runtime.allgs of the process through /proc/<pid>/mem.
+// path is the ELF file that contains the Go runtime of the process, and layout is the layout of runtime.g in it.
+// runtime.allgs is read from the symbol table, so stripped binaries are not supported.
+// The process keeps running while it is read, so the result is best-effort.
+func ReadGoroutines(pid int, path string, layout GLayout) ([]Goroutine, error) {
+	if layout.Goid == 0 || layout.Atomicstatus == 0 {
+		return nil, errors.New("the offsets of runtime.g.goid and runtime.g.atomicstatus are unknown")
+	}
+	allgs, _, err := processVariable(pid, path, "runtime.allgs")
+	if err != nil {
+		return nil, err
+	}
+	mem, err := os.Open(filepath.Join("/proc", strconv.Itoa(pid), "mem"))
+	if err != nil {
+		return nil, err
+	}
+	defer mem.Close()
+
+	// runtime.allgs is []*g.
+	header := make([]byte, 16)
+	if _, err := mem.ReadAt(header, int64(allgs)); err != nil {
+		return nil, fmt.Errorf("failed to read runtime.allgs: %w", err)
+	}
+	array := binary.LittleEndian.Uint64(header[0:8])
+	length := binary.LittleEndian.Uint64(header[8:16])
+	if length > maxGoroutines {
+		return nil, fmt.Errorf("runtime.allgs is too long: %d", length)
+	}
+	if length == 0 {
+		// The runtime has not been initialized yet.
+		return nil, nil
+	}
+	pointers := make([]byte, 8*length)
+	if _, err := mem.ReadAt(pointers, int64(array)); err != nil {
+		return nil, fmt.Errorf("failed to read the array of runtime.allgs: %w", err)
+	}
+	size := max(layout.Goid+8, layout.Atomicstatus+4, layout.Gopc+8, layout.Startpc+8)
+	buf := make([]byte, size)
+	var goroutines []Goroutine
+	for i := uint64(0); i < length; i++ {
+		gp := binary.LittleEndian.Uint64(pointers[8*i:])
+		if gp == 0 {
+			continue
+		}
+		if _, err := mem.ReadAt(buf, int64(gp)); err != nil {
+			return nil, fmt.Errorf("failed to read runtime.g at %#x: %w", gp, err)
+		}
+		if binary.LittleEndian.Uint32(buf[layout.Atomicstatus:])&^gStatusScan == gStatusDead {
+			continue
+		}
+		g := Goroutine{Id: int64(binary.LittleEndian.Uint64(buf[layout.Goid:]))}
+		if layout.Gopc != 0 {
+			g.Gopc = binary.LittleEndian.Uint64(buf[layout.Gopc:])
+		}
+		if layout.Startpc != 0 {
+			g.Startpc = binary.LittleEndian.Uint64(buf[layout.Startpc:])
+		}
+		goroutines = append(goroutines, g)
+	}
+	return goroutines, nil
+}
+
+// processVariable returns the runtime address and the size of the global variable in the process.
+func processVariable(pid int, path string, name string) (uint64, uint64, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	addr, size, err := variable(f, name)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to find %s in %s: %w", name, path, err)
+	}
+	if f.Type != elf.ET_DYN {
+		return addr, size, nil
+	}
+	bias, err := loadBias(pid, path, f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return addr + bias, size, nil
+}
+
+// variable returns the link-time address and the size of the global variable from the symbol table,
+// or from DWARF if the symbol table is stripped.
+func variable(f *elf.File, name string) (uint64, uint64, error) {
+	if symbols, err := f.Symbols(); err == nil {
+		for _, s := range symbols {
+			if s.Name == name {
+				return s.Value, s.Size, nil
+			}
+		}
+	}
+	d, err := f.DWARF()
+	if err != nil {
+		return 0, 0, fmt.Errorf("no symbol table or DWARF: %w", err)
+	}
+	r := d.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			return 0, 0, err
+		}
+		if entry == nil {
+			return 0, 0, fmt.Errorf("%s is not found", name)
+		}
+		if entry.Tag != dwarf.TagVariable {
+			if entry.Tag != dwarf.TagCompileUnit {
+				r.SkipChildren()
+			}
+			continue
+		}
+		if n, _ := entry.Val(dwarf.AttrName).(string); n != name {
+			continue
+		}
+		// The location of a global variable is DW_OP_addr followed by the address.
+		loc, _ := entry.Val(dwarf.AttrLocation).([]byte)
+		if len(loc) != 9 || loc[0] != opAddr {
+			return 0, 0, fmt.Errorf("unexpected location of %s: %x", name, loc)
+		}
+		var size uint64
+		if off, ok := entry.Val(dwarf.AttrType).(dwarf.Offset); ok {
+			if typ, err := d.Type(off); err == nil && typ.Size() > 0 {
+				size = uint64(typ.Size())
+			}
+		}
+		return f.ByteOrder.Uint64(loc[1:]), size, nil
+	}
+}
+
+// loadBias returns the difference between the runtime and the link-time addresses of the object loaded at a random address.
+// It is computed from the mapping of the first PT_LOAD segment, which starts at the beginning of the file.
+func loadBias(pid int, path string, f *elf.File) (uint64, error) {
+	var first *elf.Prog
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_LOAD && prog.Off == 0 {
+			first = prog
+			break
+		}
+	}
+	if first == nil {
+		return 0, fmt.Errorf("no PT_LOAD segment at the beginning of %s", path)
+	}
+	id, err := StatFileID(path)
+	if err != nil {
+		return 0, err
+	}
+	mappings, err := readMappings(uint32(pid))
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range mappings {
+		if m.Offset == 0 && id.isMappedBy(uint32(pid), m) {
+			// The mapping starts at the page that contains the segment.
+			return uint64(m.StartAddr) - first.Vaddr&^uint64(os.Getpagesize()-1), nil
+		}
+	}
+	return 0, fmt.Errorf("%s is not mapped by pid %d", path, pid)
+}
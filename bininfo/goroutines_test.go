@@ -0,0 +1,103 @@
+package bininfo
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// goroutinesFixture starts workers and blocks after printing "ready".
+const goroutinesFixture = `package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var c = make(chan struct{})
+
+func worker() {
+	<-c
+}
+
+func main() {
+	for i := 0; i < 3; i++ {
+		go worker()
+	}
+	fmt.Println("ready")
+	time.Sleep(time.Hour)
+}
+`
+
+// buildFixture builds the source of package main, and returns the path to the executable.
+func buildFixture(t *testing.T, source string, buildmode string, flags ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte(source), 0o644))
+	path := filepath.Join(dir, "fixture")
+	args := append([]string{"build", "-buildmode=" + buildmode, "-o", path}, flags...)
+	build := exec.Command(filepath.Join(runtime.GOROOT(), "bin", "go"), append(args, "main.go")...)
+	build.Dir = dir
+	build.Env = append(os.Environ(), "GO111MODULE=off")
+	out, err := build.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return path
+}
+
+// startFixture builds and starts the fixture, and returns the path to the executable and the pid.
+func startFixture(t *testing.T, buildmode string) (string, int) {
+	t.Helper()
+	path := buildFixture(t, goroutinesFixture, buildmode)
+	cmd := exec.Command(path)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "ready\n", line)
+	return path, cmd.Process.Pid
+}
+
+func Test_ReadGoroutines(t *testing.T) {
+	tests := []struct {
+		name      string
+		buildmode string
+	}{
+		{name: "executable", buildmode: "exe"},
+		{name: "position independent executable", buildmode: "pie"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, pid := startFixture(t, tt.buildmode)
+			layout, err := NewGLayout(path)
+			require.NoError(t, err)
+			goroutines, err := ReadGoroutines(pid, path, layout)
+			require.NoError(t, err)
+			translator, err := NewTranslator(path)
+			require.NoError(t, err)
+			// main.main and the workers in addition to the system goroutines.
+			assert.GreaterOrEqual(t, len(goroutines), 4)
+			var workers int
+			for _, g := range goroutines {
+				assert.NotZero(t, g.Id)
+				// The executable is loaded at a random address if it is position independent.
+				if f := translator.PCToFunc(g.Startpc); f != nil && f.Name == "main.worker" {
+					workers++
+				}
+			}
+			if tt.buildmode == "exe" {
+				assert.Equal(t, 3, workers)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package bininfo
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"errors"
+	"sort"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+	"github.com/go-delve/delve/pkg/dwarf/reader"
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+// Frame is a logical stack frame. A single PC corresponds to several frames
+// if the compiler inlined calls at the PC.
+type Frame struct {
+	Function string
+	File     string
+	Line     int
+	// Inlined is true if the function is inlined into the caller frame.
+	Inlined bool
+}
+
+// subprogram is the DWARF entry of a function that may contain inlined calls.
+type subprogram struct {
+	lowpc  uint64
+	highpc uint64
+	offset dwarf.Offset
+	cu     *dwarf.Entry
+}
+
+// inlineTable looks up the inlined calls at a PC from DW_TAG_inlined_subroutine entries.
+type inlineTable struct {
+	dwarf       *dwarf.Data
+	subprograms []subprogram // sorted by lowpc
+}
+
+func newInlineTable(path string) (*inlineTable, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d, err := f.DWARF()
+	if err != nil {
+		return nil, err
+	}
+	var subprograms []subprogram
+	var cu *dwarf.Entry
+	r := d.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		switch entry.Tag {
+		case dwarf.TagCompileUnit:
+			cu = entry
+			continue
+		case dwarf.TagSubprogram:
+			if entry.Children {
+				ranges, err := d.Ranges(entry)
+				if err == nil && len(ranges) > 0 {
+					subprograms = append(subprograms, subprogram{
+						lowpc:  ranges[0][0],
+						highpc: ranges[len(ranges)-1][1],
+						offset: entry.Offset,
+						cu:     cu,
+					})
+				}
+			}
+		}
+		if entry.Tag != dwarf.TagCompileUnit {
+			r.SkipChildren()
+		}
+	}
+	if len(subprograms) == 0 {
+		return nil, errors.New("no subprograms in DWARF")
+	}
+	sort.Slice(subprograms, func(i, j int) bool { return subprograms[i].lowpc < subprograms[j].lowpc })
+	return &inlineTable{dwarf: d, subprograms: subprograms}, nil
+}
+
+// frames expands the inlined calls at pc, innermost first.
+// file and line are the position of pc, and fn is the function that physically contains pc.
+func (t *inlineTable) frames(pc uint64, file string, line int, fn *proc.Function) []Frame {
+	outermost := Frame{Function: fn.Name, File: file, Line: line}
+	i := sort.Search(len(t.subprograms), func(i int) bool { return t.subprograms[i].lowpc > pc }) - 1
+	if i < 0 || t.subprograms[i].highpc <= pc {
+		return []Frame{outermost}
+	}
+	sp := t.subprograms[i]
+	tree, err := godwarf.LoadTree(sp.offset, t.dwarf, 0)
+	if err != nil {
+		return []Frame{outermost}
+	}
+	inlines := reader.InlineStack(tree, pc)
+	if len(inlines) == 0 {
+		return []Frame{outermost}
+	}
+	lr, err := t.dwarf.LineReader(sp.cu)
+	if err != nil || lr == nil {
+		return []Frame{outermost}
+	}
+	files := lr.Files()
+
+	frames := make([]Frame, 0, len(inlines)+1)
+	for _, inline := range inlines {
+		name, ok := inline.Val(dwarf.AttrName).(string)
+		fileIndex, okFile := inline.Val(dwarf.AttrCallFile).(int64)
+		callLine, okLine := inline.Val(dwarf.AttrCallLine).(int64)
+		if !ok || !okFile || !okLine || fileIndex < 0 || int(fileIndex) >= len(files) || files[fileIndex] == nil {
+			break
+		}
+		frames = append(frames, Frame{Function: name, File: file, Line: line, Inlined: true})
+		// The call site of the inlined function is the position in the caller.
+		file = files[fileIndex].Name
+		line = int(callLine)
+	}
+	outermost.File = file
+	outermost.Line = line
+	return append(frames, outermost)
+}
@@ -0,0 +1,77 @@
+package bininfo
+
+import (
+	"debug/elf"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// inlineFixture has main.inner inlined into main.middle, which is inlined into main.caller.
+const inlineFixture = `package main
+
+import "fmt"
+
+func inner(n int) int {
+	return n*n + 7
+}
+
+func middle(n int) int {
+	return inner(n) + 1
+}
+
+//go:noinline
+func caller(n int) int {
+	return middle(n) * 3
+}
+
+func main() {
+	fmt.Println(caller(3))
+}
+`
+
+func Test_Translator_PCToFrames_inlined(t *testing.T) {
+	tests := []struct {
+		name       string
+		flags      []string
+		translator reflect.Type
+	}{
+		{name: "DWARF", translator: reflect.TypeOf(&binaryInfo{})},
+		{name: "symbol table", flags: []string{"-ldflags=-w"}, translator: reflect.TypeOf(&symbolTable{})},
+		{name: ".gopclntab", flags: []string{"-ldflags=-s -w"}, translator: reflect.TypeOf(&pclnTable{})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := buildFixture(t, inlineFixture, "exe", tt.flags...)
+			source := filepath.Join(filepath.Dir(path), "main.go")
+			translator, err := NewTranslator(path)
+			require.NoError(t, err)
+			require.Equal(t, tt.translator, reflect.TypeOf(translator))
+
+			f, err := elf.Open(path)
+			require.NoError(t, err)
+			defer f.Close()
+			table, err := newGoSymTable(f)
+			require.NoError(t, err)
+			caller := table.LookupFunc("main.caller")
+			require.NotNil(t, caller)
+
+			want := []Frame{
+				{Function: "main.inner", File: source, Line: 6, Inlined: true},
+				{Function: "main.middle", File: source, Line: 10, Inlined: true},
+				{Function: "main.caller", File: source, Line: 15},
+			}
+			var found bool
+			for pc := caller.Entry; pc < caller.End && !found; pc++ {
+				frames := translator.PCToFrames(pc)
+				require.NotEmpty(t, frames, "pc %#x", pc)
+				assert.Equal(t, "main.caller", frames[len(frames)-1].Function)
+				found = reflect.DeepEqual(want, frames)
+			}
+			assert.True(t, found, "no PC of main.caller has the inlined frames")
+		})
+	}
+}
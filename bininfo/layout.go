@@ -0,0 +1,174 @@
+package bininfo
+
+import (
+	"debug/buildinfo"
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// MinGoMinorVersion is the oldest Go 1.x minor version gmon can trace.
+// The eBPF programs read the arguments and the return value of runtime.newproc1 from registers,
+// which requires the register-based calling convention introduced in Go 1.17
+// and the signature of runtime.newproc1 since Go 1.18.
+const MinGoMinorVersion = 18
+
+// GLayout holds the offsets of the runtime.g fields read by the eBPF programs.
+// A zero offset means that the field is unknown.
+type GLayout struct {
+	Goid         uint64
+	Atomicstatus uint64
+	Gopc         uint64
+	Startpc      uint64
+	Param        uint64
+	// SudogC is the offset of runtime.sudog.c, the channel that a goroutine parked in select is woken up by.
+	SudogC uint64
+}
+
+// NewGLayout resolves the layout of runtime.g in the given executable.
+// The layout is read from DWARF when available. Otherwise, it falls back to
+// the built-in layout of the Go version that built the executable.
+func NewGLayout(path string) (GLayout, error) {
+	layout, err := gLayoutFromDWARF(path)
+	if err == nil {
+		slog.Debug("loaded runtime.g layout from DWARF", slog.Any("layout", layout))
+		return layout, nil
+	}
+	slog.Debug("failed to load runtime.g layout from DWARF", slog.Any("error", err))
+
+	binfo, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return GLayout{}, err
+	}
+	layout, err = gLayoutFromVersion(binfo.GoVersion)
+	if err != nil {
+		return GLayout{}, err
+	}
+	slog.Debug("loaded runtime.g layout from Go version", slog.String("version", binfo.GoVersion), slog.Any("layout", layout))
+	return layout, nil
+}
+
+func gLayoutFromDWARF(path string) (GLayout, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return GLayout{}, err
+	}
+	defer f.Close()
+	d, err := f.DWARF()
+	if err != nil {
+		return GLayout{}, err
+	}
+	offsets, err := structFieldOffsets(d, "runtime.g")
+	if err != nil {
+		return GLayout{}, err
+	}
+	var layout GLayout
+	for name, dst := range map[string]*uint64{
+		"goid":         &layout.Goid,
+		"atomicstatus": &layout.Atomicstatus,
+	} {
+		offset, ok := offsets[name]
+		if !ok {
+			return GLayout{}, fmt.Errorf("runtime.g.%s is not found in DWARF", name)
+		}
+		*dst = offset
+	}
+	// The other fields are optional, and left unknown if they are renamed in a newer Go version.
+	layout.Gopc = offsets["gopc"]
+	layout.Startpc = offsets["startpc"]
+	layout.Param = offsets["param"]
+	if offsets, err := structFieldOffsets(d, "runtime.sudog"); err == nil {
+		layout.SudogC = offsets["c"]
+	}
+	return layout, nil
+}
+
+// structFieldOffsets returns the offsets of the fields of the named struct type.
+func structFieldOffsets(d *dwarf.Data, typeName string) (map[string]uint64, error) {
+	r := d.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("%s is not found in DWARF", typeName)
+		}
+		if entry.Tag != dwarf.TagStructType {
+			if entry.Tag != dwarf.TagCompileUnit {
+				r.SkipChildren()
+			}
+			continue
+		}
+		if name, _ := entry.Val(dwarf.AttrName).(string); name != typeName || !entry.Children {
+			r.SkipChildren()
+			continue
+		}
+		offsets := make(map[string]uint64)
+		for {
+			member, err := r.Next()
+			if err != nil {
+				return nil, err
+			}
+			if member == nil || member.Tag == 0 {
+				return offsets, nil
+			}
+			if member.Tag != dwarf.TagMember {
+				continue
+			}
+			name, _ := member.Val(dwarf.AttrName).(string)
+			offset, ok := member.Val(dwarf.AttrDataMemberLoc).(int64)
+			if name == "" || !ok {
+				continue
+			}
+			offsets[name] = uint64(offset)
+		}
+	}
+}
+
+// gLayoutFromVersion returns the layout of runtime.g on amd64 for the given Go version.
+// The offsets are read from the DWARF of the executables built by each Go version.
+// https://github.com/golang/go/blob/release-branch.go1.23/src/runtime/runtime2.go#L458
+func gLayoutFromVersion(version string) (GLayout, error) {
+	minor, ok := GoMinorVersion(version)
+	if !ok {
+		return GLayout{}, fmt.Errorf("unknown Go version %q", version)
+	}
+	switch {
+	case minor < MinGoMinorVersion:
+		return GLayout{}, fmt.Errorf("Go %s is not supported", version)
+	case minor <= 20:
+		return GLayout{Goid: 152, Atomicstatus: 144, Gopc: 296, Startpc: 312, Param: 136, SudogC: 80}, nil
+	case minor <= 22:
+		// Go 1.21 moved the tracer fields to the end of runtime.g and added parentGoid before gopc.
+		return GLayout{Goid: 152, Atomicstatus: 144, Gopc: 280, Startpc: 296, Param: 136, SudogC: 80}, nil
+	case minor <= 24:
+		// Go 1.23 added runtime.g.syscallbp before param.
+		return GLayout{Goid: 160, Atomicstatus: 152, Gopc: 288, Startpc: 304, Param: 144, SudogC: 80}, nil
+	case minor == 25:
+		// Go 1.25 removed runtime.gobuf.ret, which cancels out runtime.g.syscallbp.
+		return GLayout{Goid: 152, Atomicstatus: 144, Gopc: 280, Startpc: 296, Param: 136, SudogC: 80}, nil
+	default:
+		// Go 1.26 added fields before gopc and enlarged runtime.sudog.elem before c.
+		return GLayout{Goid: 152, Atomicstatus: 144, Gopc: 288, Startpc: 304, Param: 136, SudogC: 88}, nil
+	}
+}
+
+// GoMinorVersion returns the minor version of a Go 1.x version string such as "go1.23.1".
+func GoMinorVersion(version string) (int, bool) {
+	v, ok := strings.CutPrefix(version, "go1.")
+	if !ok {
+		return 0, false
+	}
+	if i := strings.IndexFunc(v, func(r rune) bool { return r < '0' || '9' < r }); i >= 0 {
+		v = v[:i]
+	}
+	minor, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, false
+	}
+	return minor, true
+}
@@ -0,0 +1,69 @@
+package bininfo
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GoMinorVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    int
+		wantOk  bool
+	}{
+		{version: "go1.23.1", want: 23, wantOk: true},
+		{version: "go1.20", want: 20, wantOk: true},
+		{version: "go1.24rc1", want: 24, wantOk: true},
+		{version: "devel go1.24-abcdef", wantOk: false},
+		{version: "go2.0", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, ok := GoMinorVersion(tt.version)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_gLayoutFromVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    GLayout
+		wantErr bool
+	}{
+		{version: "go1.17.13", wantErr: true},
+		{version: "go1.18.10", want: GLayout{Goid: 152, Atomicstatus: 144, Gopc: 296, Startpc: 312, Param: 136, SudogC: 80}},
+		{version: "go1.20.14", want: GLayout{Goid: 152, Atomicstatus: 144, Gopc: 296, Startpc: 312, Param: 136, SudogC: 80}},
+		{version: "go1.21.13", want: GLayout{Goid: 152, Atomicstatus: 144, Gopc: 280, Startpc: 296, Param: 136, SudogC: 80}},
+		{version: "go1.22.7", want: GLayout{Goid: 152, Atomicstatus: 144, Gopc: 280, Startpc: 296, Param: 136, SudogC: 80}},
+		{version: "go1.23.1", want: GLayout{Goid: 160, Atomicstatus: 152, Gopc: 288, Startpc: 304, Param: 144, SudogC: 80}},
+		{version: "go1.24.0", want: GLayout{Goid: 160, Atomicstatus: 152, Gopc: 288, Startpc: 304, Param: 144, SudogC: 80}},
+		{version: "go1.25.0", want: GLayout{Goid: 152, Atomicstatus: 144, Gopc: 280, Startpc: 296, Param: 136, SudogC: 80}},
+		{version: "go1.26.0", want: GLayout{Goid: 152, Atomicstatus: 144, Gopc: 288, Startpc: 304, Param: 136, SudogC: 88}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, err := gLayoutFromVersion(tt.version)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_gLayoutFromVersion_DWARF(t *testing.T) {
+	// The built-in layout of the Go version that builds the fixture must match DWARF.
+	path := buildFixture(t, goroutinesFixture, "exe")
+	want, err := gLayoutFromDWARF(path)
+	require.NoError(t, err)
+	got, err := gLayoutFromVersion(runtime.Version())
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
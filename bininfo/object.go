@@ -0,0 +1,49 @@
+package bininfo
+
+import (
+	"debug/buildinfo"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/procfs"
+)
+
+// ErrNoGoRuntime is returned by GoObject if neither the executable nor the shared objects loaded by the process contain the Go runtime.
+var ErrNoGoRuntime = errors.New("no Go runtime is found")
+
+// GoObject returns the path to the ELF file that contains the Go runtime of the executable.
+// It is the executable itself, or a Go shared object loaded by the process if the executable is not built by Go,
+// e.g. a C++ program that loads a library built with -buildmode=c-shared.
+func GoObject(path string, pid int) (string, error) {
+	if _, err := buildinfo.ReadFile(path); err == nil {
+		return path, nil
+	}
+	if pid == 0 {
+		return "", fmt.Errorf("%s is not built by Go, so pid is required to find a Go shared object loaded by the process", path)
+	}
+	proc, err := procfs.NewProc(pid)
+	if err != nil {
+		return "", err
+	}
+	mappings, err := proc.ProcMaps()
+	if err != nil {
+		return "", fmt.Errorf("failed to read /proc/%d/maps: %w", pid, err)
+	}
+	seen := make(map[string]bool)
+	for _, m := range mappings {
+		// Skip anonymous mappings and pseudo paths such as [heap] and [vdso].
+		if m.Pathname == "" || strings.HasPrefix(m.Pathname, "[") || seen[m.Pathname] {
+			continue
+		}
+		seen[m.Pathname] = true
+		// The path in the mappings is in the mount namespace of the process.
+		objectPath := filepath.Join("/proc", strconv.Itoa(pid), "root", m.Pathname)
+		if _, err := buildinfo.ReadFile(objectPath); err == nil {
+			return objectPath, nil
+		}
+	}
+	return "", fmt.Errorf("%w in %s or the shared objects loaded by pid %d", ErrNoGoRuntime, path, pid)
+}
@@ -0,0 +1,50 @@
+package bininfo
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GoObject(t *testing.T) {
+	executable, err := os.Executable()
+	require.NoError(t, err)
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep is not found")
+	}
+	cmd := exec.Command(sleep, "60")
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	tests := []struct {
+		name    string
+		path    string
+		pid     int
+		want    string
+		wantErr error
+	}{
+		{name: "Go executable", path: executable, want: executable},
+		{name: "Go executable with pid", path: executable, pid: os.Getpid(), want: executable},
+		{name: "non-Go executable without Go shared objects", path: sleep, pid: cmd.Process.Pid, wantErr: ErrNoGoRuntime},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GoObject(tt.path, tt.pid)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	_, err = GoObject(sleep, 0)
+	assert.Error(t, err, "pid is required to find a Go shared object")
+}
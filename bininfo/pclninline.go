@@ -0,0 +1,292 @@
+package bininfo
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/gosym"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	// Magic numbers of .gopclntab since Go 1.18.
+	// https://github.com/golang/go/blob/release-branch.go1.23/src/internal/abi/symtab.go#L22
+	go118PCLnTabMagic = 0xfffffff0
+	go120PCLnTabMagic = 0xfffffff1
+	// pcdataInlTreeIndex and funcdataInlTree are the indices of the inline tree in runtime._func.
+	// https://github.com/golang/go/blob/release-branch.go1.23/src/internal/abi/symtab.go#L110
+	pcdataInlTreeIndex = 2
+	funcdataInlTree    = 3
+	// maxInlineDepth bounds the inlined calls expanded at a PC in case the inline tree is broken.
+	maxInlineDepth = 64
+)
+
+// pclnInlineTree expands inlined calls with the inline trees in .gopclntab, which the runtime uses for stack traces.
+// The inline trees are in go:func.*, which is found through runtime.firstmoduledata.
+// https://github.com/golang/go/blob/release-branch.go1.23/src/runtime/symtab.go#L1176
+type pclnInlineTree struct {
+	table       *gosym.Table
+	textStart   uint64
+	nfunc       int
+	minLC       uint64
+	funcnametab []byte
+	pctab       []byte
+	functab     []byte
+	funcSize    int // the size of runtime._func without pcdata and funcdata
+	callSize    int // the size of runtime.inlinedCall
+	gofunc      []byte
+}
+
+// runtimeFunc is a runtime._func.
+type runtimeFunc struct {
+	entry     uint64
+	data      []byte
+	size      int // the size without pcdata and funcdata
+	npcdata   uint32
+	nfuncdata uint32
+}
+
+// newPclnInlineTree loads the inline trees of the ELF file built by the Go version.
+func newPclnInlineTree(f *elf.File, goVersion string, table *gosym.Table) (*pclnInlineTree, error) {
+	section := f.Section(".gopclntab")
+	text := f.Section(".text")
+	if section == nil || text == nil {
+		return nil, errors.New("no .gopclntab or .text section")
+	}
+	pclntab, err := section.Data()
+	if err != nil {
+		return nil, err
+	}
+	if len(pclntab) < 72 {
+		return nil, errors.New(".gopclntab is too short")
+	}
+	t := &pclnInlineTree{table: table, textStart: text.Addr}
+	switch binary.LittleEndian.Uint32(pclntab) {
+	case go118PCLnTabMagic:
+		t.funcSize = 40
+		t.callSize = 20
+	case go120PCLnTabMagic:
+		// Go 1.20 added runtime._func.startLine and removed the call site from runtime.inlinedCall.
+		t.funcSize = 44
+		t.callSize = 16
+	default:
+		return nil, fmt.Errorf("unsupported .gopclntab magic %#x", binary.LittleEndian.Uint32(pclntab))
+	}
+	if pclntab[7] != 8 {
+		return nil, fmt.Errorf("unsupported pointer size %d", pclntab[7])
+	}
+	t.minLC = uint64(pclntab[6])
+	t.nfunc = int(binary.LittleEndian.Uint64(pclntab[8:]))
+	funcnameOffset := binary.LittleEndian.Uint64(pclntab[32:])
+	pctabOffset := binary.LittleEndian.Uint64(pclntab[56:])
+	pclnOffset := binary.LittleEndian.Uint64(pclntab[64:])
+	if funcnameOffset > uint64(len(pclntab)) || pctabOffset > uint64(len(pclntab)) || pclnOffset > uint64(len(pclntab)) {
+		return nil, errors.New("broken .gopclntab header")
+	}
+	t.funcnametab = pclntab[funcnameOffset:]
+	t.pctab = pclntab[pctabOffset:]
+	t.functab = pclntab[pclnOffset:]
+	if len(t.functab) < 8*(t.nfunc+1) {
+		return nil, errors.New("broken .gopclntab functab")
+	}
+	gofunc, err := goFunc(f, goVersion, section.Addr, section.Addr+funcnameOffset)
+	if err != nil {
+		return nil, err
+	}
+	t.gofunc, err = readLoaded(f, gofunc)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// goFunc returns the address of go:func.* from runtime.firstmoduledata, whose first fields are
+// the address of .gopclntab and the function name table in it.
+func goFunc(f *elf.File, goVersion string, pclntab, funcnametab uint64) (uint64, error) {
+	minor, ok := GoMinorVersion(goVersion)
+	if !ok {
+		return 0, fmt.Errorf("unknown Go version %q", goVersion)
+	}
+	// The offsets of runtime.moduledata.gofunc are read from the DWARF of the executables built by each Go version.
+	var offset int
+	switch {
+	case minor <= 19:
+		offset = 304
+	case minor <= 26:
+		// Go 1.20 added covctrs and ecovctrs.
+		offset = 320
+	default:
+		offset = 344
+	}
+	rodata := f.Section(".rodata")
+	if rodata == nil {
+		return 0, errors.New("no .rodata section")
+	}
+	var header [16]byte
+	binary.LittleEndian.PutUint64(header[0:], pclntab)
+	binary.LittleEndian.PutUint64(header[8:], funcnametab)
+	// runtime.firstmoduledata is in .go.module since Go 1.26, and in .noptrdata before.
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_PROGBITS || s.Flags&elf.SHF_WRITE == 0 {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			continue
+		}
+		for i := 0; i+offset+8 <= len(data); i += 8 {
+			if !bytes.Equal(data[i:i+16], header[:]) {
+				continue
+			}
+			// runtime.moduledata.rodata precedes gofunc in all Go versions.
+			if binary.LittleEndian.Uint64(data[i+offset-8:]) != rodata.Addr {
+				return 0, fmt.Errorf("unexpected layout of runtime.moduledata for Go %s", goVersion)
+			}
+			return binary.LittleEndian.Uint64(data[i+offset:]), nil
+		}
+	}
+	return 0, errors.New("runtime.firstmoduledata is not found")
+}
+
+// readLoaded reads the loadable segment from the address to the end.
+func readLoaded(f *elf.File, addr uint64) ([]byte, error) {
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD || addr < prog.Vaddr || prog.Vaddr+prog.Filesz <= addr {
+			continue
+		}
+		data := make([]byte, prog.Vaddr+prog.Filesz-addr)
+		if _, err := prog.ReadAt(data, int64(addr-prog.Vaddr)); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("%#x is not in any loadable segment", addr)
+}
+
+// frames expands the inlined calls at pc, innermost first.
+// file and line are the position of pc, and fn is the function that physically contains pc.
+func (t *pclnInlineTree) frames(pc uint64, file string, line int, fn string) []Frame {
+	f, ok := t.funcAt(pc)
+	if !ok {
+		return []Frame{{Function: fn, File: file, Line: line}}
+	}
+	var frames []Frame
+	for len(frames) < maxInlineDepth {
+		index, ok := t.pcvalue(f, f.pcdata(pcdataInlTreeIndex), pc)
+		if !ok || index < 0 {
+			break
+		}
+		name, parentPc, ok := t.inlinedCall(f, index)
+		if !ok {
+			break
+		}
+		frames = append(frames, Frame{Function: name, File: file, Line: line, Inlined: true})
+		// The position of the parent PC is the call site of the inlined function in the caller.
+		pc = f.entry + parentPc
+		file, line, _ = t.table.PCToLine(pc)
+	}
+	return append(frames, Frame{Function: fn, File: file, Line: line})
+}
+
+// funcAt returns the runtime._func that contains pc.
+func (t *pclnInlineTree) funcAt(pc uint64) (runtimeFunc, bool) {
+	if pc < t.textStart {
+		return runtimeFunc{}, false
+	}
+	entryOff := func(i int) uint64 { return uint64(binary.LittleEndian.Uint32(t.functab[8*i:])) }
+	// The functab has a sentinel entry at the end of the text.
+	i := sort.Search(t.nfunc, func(i int) bool { return pc < t.textStart+entryOff(i+1) })
+	if i == t.nfunc {
+		return runtimeFunc{}, false
+	}
+	funcOff := binary.LittleEndian.Uint32(t.functab[8*i+4:])
+	if uint64(funcOff)+uint64(t.funcSize) > uint64(len(t.functab)) {
+		return runtimeFunc{}, false
+	}
+	data := t.functab[funcOff:]
+	return runtimeFunc{
+		entry:     t.textStart + entryOff(i),
+		data:      data,
+		size:      t.funcSize,
+		npcdata:   binary.LittleEndian.Uint32(data[28:]),
+		nfuncdata: uint32(data[t.funcSize-1]),
+	}, true
+}
+
+func (f runtimeFunc) pcdata(index uint32) uint32 {
+	if index >= f.npcdata {
+		return 0
+	}
+	return f.uint32At(f.size + 4*int(index))
+}
+
+func (f runtimeFunc) uint32At(off int) uint32 {
+	if off+4 > len(f.data) {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(f.data[off:])
+}
+
+// pcvalue decodes the value of pc in the table at the offset of pctab.
+// https://github.com/golang/go/blob/release-branch.go1.23/src/runtime/symtab.go#L1000
+func (t *pclnInlineTree) pcvalue(f runtimeFunc, off uint32, pc uint64) (int32, bool) {
+	if off == 0 || uint64(off) >= uint64(len(t.pctab)) {
+		return 0, false
+	}
+	p := t.pctab[off:]
+	value := int32(-1)
+	valuePC := f.entry
+	for first := true; ; first = false {
+		uvdelta, n := binary.Uvarint(p)
+		if n <= 0 || (uvdelta == 0 && !first) {
+			return 0, false
+		}
+		p = p[n:]
+		value += int32(-(uint32(uvdelta) & 1) ^ (uint32(uvdelta) >> 1))
+		pcdelta, n := binary.Uvarint(p)
+		if n <= 0 {
+			return 0, false
+		}
+		p = p[n:]
+		valuePC += pcdelta * t.minLC
+		if pc < valuePC {
+			return value, true
+		}
+	}
+}
+
+// inlinedCall returns the name and the parent PC offset of the runtime.inlinedCall at the index of the inline tree.
+func (t *pclnInlineTree) inlinedCall(f runtimeFunc, index int32) (string, uint64, bool) {
+	if f.nfuncdata <= funcdataInlTree {
+		return "", 0, false
+	}
+	off := f.uint32At(f.size + 4*int(f.npcdata) + 4*funcdataInlTree)
+	if off == ^uint32(0) {
+		return "", 0, false
+	}
+	start := uint64(off) + uint64(index)*uint64(t.callSize)
+	if start+uint64(t.callSize) > uint64(len(t.gofunc)) {
+		return "", 0, false
+	}
+	call := t.gofunc[start:]
+	var nameOff int32
+	var parentPc int32
+	if t.callSize == 20 {
+		// Go 1.18 and 1.19 have the parent index and the call site before the name.
+		nameOff = int32(binary.LittleEndian.Uint32(call[12:]))
+		parentPc = int32(binary.LittleEndian.Uint32(call[16:]))
+	} else {
+		nameOff = int32(binary.LittleEndian.Uint32(call[4:]))
+		parentPc = int32(binary.LittleEndian.Uint32(call[8:]))
+	}
+	if nameOff < 0 || int(nameOff) >= len(t.funcnametab) || parentPc < 0 {
+		return "", 0, false
+	}
+	name := t.funcnametab[nameOff:]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	return string(name), uint64(parentPc), true
+}
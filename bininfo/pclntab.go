@@ -0,0 +1,119 @@
+package bininfo
+
+import (
+	"debug/buildinfo"
+	"debug/elf"
+	"debug/gosym"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+// newGoSymTable loads the Go symbol table from .gopclntab.
+// The Go linker keeps .gopclntab even if the executable is stripped by -ldflags="-s -w"
+// since the runtime needs it for stack traces.
+func newGoSymTable(f *elf.File) (*gosym.Table, error) {
+	pclntab := f.Section(".gopclntab")
+	if pclntab == nil {
+		return nil, errors.New("no .gopclntab section")
+	}
+	data, err := pclntab.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .gopclntab: %w", err)
+	}
+	text := f.Section(".text")
+	if text == nil {
+		return nil, errors.New("no .text section")
+	}
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(data, text.Addr))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse .gopclntab: %w", err)
+	}
+	return table, nil
+}
+
+// loadPclnInlineTree loads the inline trees from .gopclntab of the executable without DWARF.
+// It returns nil if the inline trees are not available, so inlined frames are not expanded.
+func loadPclnInlineTree(path string, f *elf.File, table *gosym.Table) *pclnInlineTree {
+	binfo, err := buildinfo.ReadFile(path)
+	if err != nil {
+		slog.Debug("failed to read the Go version, so inlined frames are not expanded", slog.Any("error", err))
+		return nil
+	}
+	inlines, err := newPclnInlineTree(f, binfo.GoVersion, table)
+	if err != nil {
+		slog.Debug("failed to load the inline trees, so inlined frames are not expanded", slog.Any("error", err))
+		return nil
+	}
+	return inlines
+}
+
+// pclnTable is a Translator for stripped executables that have neither DWARF nor symbol tables.
+type pclnTable struct {
+	table     *gosym.Table
+	addresses map[string]uint64
+	functions map[uint64]*proc.Function // keyed by the entry address
+	inlines   *pclnInlineTree           // nil if the inline trees are not available
+}
+
+func newPclnTable(path string) (*pclnTable, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	table, err := newGoSymTable(f)
+	if err != nil {
+		return nil, err
+	}
+	segments := newSegments(f)
+	addresses := make(map[string]uint64, len(table.Funcs))
+	functions := make(map[uint64]*proc.Function, len(table.Funcs))
+	for _, fn := range table.Funcs {
+		addresses[fn.Name] = segments.fileOffset(fn.Entry)
+		functions[fn.Entry] = &proc.Function{
+			Name:  fn.Name,
+			Entry: fn.Entry,
+			End:   fn.End,
+		}
+	}
+	return &pclnTable{
+		table:     table,
+		addresses: addresses,
+		functions: functions,
+		inlines:   loadPclnInlineTree(path, f, table),
+	}, nil
+}
+
+func (t *pclnTable) Address(symbol string) uint64 {
+	return t.addresses[symbol]
+}
+
+func (t *pclnTable) PCToFunc(pc uint64) *proc.Function {
+	fn := t.table.PCToFunc(pc)
+	if fn == nil {
+		return nil
+	}
+	return t.functions[fn.Entry]
+}
+
+func (t *pclnTable) PCToLine(pc uint64) (string, int, *proc.Function) {
+	file, line, fn := t.table.PCToLine(pc)
+	if fn == nil {
+		return "", 0, nil
+	}
+	return file, line, t.functions[fn.Entry]
+}
+
+func (t *pclnTable) PCToFrames(pc uint64) []Frame {
+	file, line, f := t.PCToLine(pc)
+	if f == nil {
+		return nil
+	}
+	if t.inlines == nil {
+		return []Frame{{Function: f.Name, File: file, Line: line}}
+	}
+	return t.inlines.frames(pc, file, line, f.Name)
+}
@@ -0,0 +1,71 @@
+package bininfo
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_pclnTable(t *testing.T) {
+	path, err := os.Executable()
+	require.NoError(t, err)
+	table, err := newPclnTable(path)
+	require.NoError(t, err)
+
+	for _, symbol := range []string{"runtime.newproc1", "runtime.goexit1"} {
+		t.Run(symbol, func(t *testing.T) {
+			assert.NotZero(t, table.Address(symbol))
+			fn := table.table.LookupFunc(symbol)
+			require.NotNil(t, fn)
+			got := table.PCToFunc(fn.Entry + 1)
+			require.NotNil(t, got)
+			assert.Equal(t, symbol, got.Name)
+			file, line, got := table.PCToLine(fn.Entry)
+			require.NotNil(t, got)
+			assert.Equal(t, symbol, got.Name)
+			assert.Contains(t, file, "runtime/proc.go")
+			assert.NotZero(t, line)
+		})
+	}
+	assert.Nil(t, table.PCToFunc(0))
+}
+
+// cgoFixture is dynamically linked, so it has the dynamic symbols of libc even if it is stripped.
+const cgoFixture = `package main
+
+// #include <stdlib.h>
+import "C"
+
+//export Add
+func Add(a, b C.int) C.int {
+	return a + b
+}
+
+func main() {
+	C.free(C.malloc(1))
+}
+`
+
+func Test_NewTranslator_strippedCgo(t *testing.T) {
+	t.Setenv("CGO_ENABLED", "1")
+	tests := []struct {
+		name      string
+		buildmode string
+	}{
+		{name: "executable", buildmode: "exe"},
+		{name: "shared object", buildmode: "c-shared"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := buildFixture(t, cgoFixture, tt.buildmode, "-ldflags=-s -w")
+			translator, err := NewTranslator(path)
+			require.NoError(t, err)
+			assert.IsType(t, &pclnTable{}, translator)
+			for _, symbol := range []string{"runtime.newproc1", "runtime.goexit1"} {
+				assert.NotZero(t, translator.Address(symbol), symbol)
+			}
+		})
+	}
+}
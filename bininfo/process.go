@@ -0,0 +1,284 @@
+package bininfo
+
+import (
+	"debug/elf"
+	"fmt"
+	"log/slog"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/prometheus/procfs"
+)
+
+// segment is an executable PT_LOAD segment of an ELF file.
+type segment struct {
+	vaddr uint64
+	off   uint64
+	size  uint64
+}
+
+type segments []segment
+
+func newSegments(f *elf.File) segments {
+	var s segments
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD || (prog.Flags&elf.PF_X) == 0 {
+			continue
+		}
+		s = append(s, segment{vaddr: prog.Vaddr, off: prog.Off, size: prog.Memsz})
+	}
+	return s
+}
+
+// fileOffset converts the virtual address of a function to the offset in the file.
+func (s segments) fileOffset(vaddr uint64) uint64 {
+	for _, seg := range s {
+		if seg.vaddr <= vaddr && vaddr < seg.vaddr+seg.size {
+			return vaddr - seg.vaddr + seg.off
+		}
+	}
+	return vaddr
+}
+
+// vaddr converts the offset in the file to the link-time virtual address.
+func (s segments) vaddr(off uint64) (uint64, bool) {
+	for _, seg := range s {
+		if seg.off <= off && off < seg.off+seg.size {
+			return off - seg.off + seg.vaddr, true
+		}
+	}
+	return 0, false
+}
+
+// FileID identifies a file by the device and the inode.
+// Inode numbers are only unique within a device, and files in different containers or overlayfs layers can share them.
+// The same file reached through different paths, e.g. /proc/<pid>/root of each container, has the same FileID.
+type FileID struct {
+	dev   uint64
+	inode uint64
+}
+
+// StatFileID returns the identity of the file at the path.
+func StatFileID(path string) (FileID, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return FileID{}, err
+	}
+	return FileID{dev: st.Dev, inode: st.Ino}, nil
+}
+
+// isMappedBy reports whether the mapping of the process is backed by the file.
+func (id FileID) isMappedBy(pid uint32, m *procfs.ProcMap) bool {
+	if (FileID{dev: m.Dev, inode: m.Inode}) == id {
+		return true
+	}
+	// Before Linux 6.9, /proc/<pid>/maps shows the device and the inode of the underlying layer of overlayfs,
+	// while stat shows the ones of the overlay. The link in map_files resolves to the file that the process mapped.
+	mapped, err := StatFileID(fmt.Sprintf("/proc/%d/map_files/%x-%x", pid, m.StartAddr, m.EndAddr))
+	return err == nil && mapped == id
+}
+
+// object is an ELF file mapped into processes, such as the executable and shared objects.
+type object struct {
+	translator Translator
+	path       string
+	id         FileID
+	segments   segments
+	// dynamic is true if the object is loaded at a random address,
+	// such as position independent executables and shared objects.
+	dynamic bool
+}
+
+func newObject(path string, translator Translator) (*object, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	id, err := StatFileID(path)
+	if err != nil {
+		return nil, err
+	}
+	return &object{
+		translator: translator,
+		path:       path,
+		id:         id,
+		segments:   newSegments(f),
+		dynamic:    f.Type == elf.ET_DYN,
+	}, nil
+}
+
+// contains reports whether the link-time address is in the executable segments of the object.
+func (o *object) contains(addr uint64) bool {
+	for _, seg := range o.segments {
+		if seg.vaddr <= addr && addr < seg.vaddr+seg.size {
+			return true
+		}
+	}
+	return false
+}
+
+// isMappedBy reports whether the mapping of the process is backed by the object.
+// The file identity is compared first since the path differs from the one of gmon in containers.
+func (o *object) isMappedBy(pid uint32, m *procfs.ProcMap) bool {
+	if o.id.inode != 0 && m.Inode != 0 {
+		return o.id.isMappedBy(pid, m)
+	}
+	return o.path == m.Pathname
+}
+
+// ProcessTranslator symbolizes PCs observed in processes running the executable and shared objects.
+// Position independent executables and shared objects are loaded at a random address,
+// so a runtime PC is translated to the link-time address of the object using the mappings in /proc/<pid>/maps.
+type ProcessTranslator struct {
+	objectsMu sync.RWMutex
+	objects   []*object
+
+	mu       sync.Mutex
+	mappings *expirable.LRU[uint32, []*procfs.ProcMap]
+}
+
+// NewProcessTranslator creates a new ProcessTranslator without objects. Add objects with AddObject.
+func NewProcessTranslator() *ProcessTranslator {
+	return &ProcessTranslator{
+		mappings: expirable.NewLRU[uint32, []*procfs.ProcMap](
+			128, // cache size
+			nil,
+			10*time.Minute, // TTL of each cache entry
+		),
+	}
+}
+
+// AddObject adds an ELF file mapped into the processes, such as an executable and a Go shared object.
+// It is safe to add objects while PCs are translated.
+func (p *ProcessTranslator) AddObject(path string, translator Translator) error {
+	o, err := newObject(path, translator)
+	if err != nil {
+		return err
+	}
+	p.objectsMu.Lock()
+	defer p.objectsMu.Unlock()
+	for _, added := range p.objects {
+		// The same file can be added through different paths, e.g. /proc/<pid>/root of each container.
+		if added.path == o.path || (o.id.inode != 0 && added.id == o.id) {
+			return nil
+		}
+	}
+	p.objects = append(p.objects, o)
+	return nil
+}
+
+// RemoveObject removes the object of the file identity added by AddObject, e.g. after all processes running it exit.
+func (p *ProcessTranslator) RemoveObject(id FileID) {
+	p.objectsMu.Lock()
+	defer p.objectsMu.Unlock()
+	for i, o := range p.objects {
+		if o.id == id {
+			p.objects = append(p.objects[:i], p.objects[i+1:]...)
+			return
+		}
+	}
+}
+
+// PCToFrames returns the logical frames of the runtime PC in the process, innermost first.
+// It returns nil if the PC is not in any known object.
+func (p *ProcessTranslator) PCToFrames(pid uint32, pc uint64) []Frame {
+	o, addr, ok := p.linkTimeAddress(pid, pc)
+	if !ok {
+		return nil
+	}
+	return o.translator.PCToFrames(addr)
+}
+
+// linkTimeAddress translates the runtime PC in the process to the object and the link-time address in it.
+func (p *ProcessTranslator) linkTimeAddress(pid uint32, pc uint64) (*object, uint64, bool) {
+	p.objectsMu.RLock()
+	defer p.objectsMu.RUnlock()
+	m, err := p.mapping(pid, pc)
+	if err != nil {
+		// The process may have exited. Only objects loaded at the link-time address can be symbolized,
+		// and only if a single one contains the PC since non-PIE executables are usually linked at the same address.
+		slog.Debug("failed to read process mappings", slog.Uint64("pid", uint64(pid)), slog.Any("error", err))
+		var found *object
+		for _, o := range p.objects {
+			if o.dynamic || !o.contains(pc) {
+				continue
+			}
+			if found != nil {
+				return nil, 0, false
+			}
+			found = o
+		}
+		if found == nil {
+			return nil, 0, false
+		}
+		return found, pc, true
+	}
+	if m == nil {
+		return nil, 0, false
+	}
+	for _, o := range p.objects {
+		if !o.isMappedBy(pid, m) {
+			continue
+		}
+		if !o.dynamic {
+			// The object is always loaded at the link-time address.
+			return o, pc, true
+		}
+		addr, ok := o.segments.vaddr(pc - uint64(m.StartAddr) + uint64(m.Offset))
+		return o, addr, ok
+	}
+	return nil, 0, false
+}
+
+// mapping returns the mapping that contains the runtime PC in the process, or nil if no mapping contains it.
+// The cached mappings are refreshed if no mapping contains the PC since shared objects can be loaded later by dlopen.
+func (p *ProcessTranslator) mapping(pid uint32, pc uint64) (*procfs.ProcMap, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	mappings, cached := p.mappings.Get(pid)
+	if m := findMapping(mappings, pc); m != nil {
+		return m, nil
+	}
+	if cached {
+		p.mappings.Remove(pid)
+	}
+	mappings, err := p.processMappings(pid)
+	if err != nil {
+		return nil, err
+	}
+	return findMapping(mappings, pc), nil
+}
+
+func findMapping(mappings []*procfs.ProcMap, pc uint64) *procfs.ProcMap {
+	for _, m := range mappings {
+		if uint64(m.StartAddr) <= pc && pc < uint64(m.EndAddr) {
+			return m
+		}
+	}
+	return nil
+}
+
+// processMappings reads and caches the mappings of the process. The caller must hold p.mu.
+func (p *ProcessTranslator) processMappings(pid uint32) ([]*procfs.ProcMap, error) {
+	mappings, err := readMappings(pid)
+	if err != nil {
+		return nil, err
+	}
+	p.mappings.Add(pid, mappings)
+	return mappings, nil
+}
+
+func readMappings(pid uint32) ([]*procfs.ProcMap, error) {
+	proc, err := procfs.NewProc(int(pid))
+	if err != nil {
+		return nil, err
+	}
+	mappings, err := proc.ProcMaps()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /proc/%d/maps: %w", pid, err)
+	}
+	return mappings, nil
+}
@@ -0,0 +1,133 @@
+package bininfo
+
+import (
+	"math"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/prometheus/procfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ProcessTranslator_PCToFrames(t *testing.T) {
+	path, err := os.Executable()
+	require.NoError(t, err)
+	translator, err := newPclnTable(path)
+	require.NoError(t, err)
+	p := NewProcessTranslator()
+	require.NoError(t, p.AddObject(path, translator))
+
+	pc := uint64(reflect.ValueOf(Test_ProcessTranslator_PCToFrames).Pointer())
+	frames := p.PCToFrames(uint32(os.Getpid()), pc)
+	require.NotEmpty(t, frames)
+	assert.Equal(t, "github.com/keisku/gmon/bininfo.Test_ProcessTranslator_PCToFrames", frames[len(frames)-1].Function)
+
+	id, err := StatFileID(path)
+	require.NoError(t, err)
+	p.RemoveObject(id)
+	assert.Nil(t, p.PCToFrames(uint32(os.Getpid()), pc))
+}
+
+func Test_ProcessTranslator_linkTimeAddress(t *testing.T) {
+	executable := &object{
+		path:     "/usr/bin/app",
+		id:       FileID{dev: 0x801, inode: 42},
+		segments: segments{{vaddr: 0x1000, off: 0x1000, size: 0x2000}},
+		dynamic:  true,
+	}
+	library := &object{
+		path:     "/proc/1/root/usr/lib/libgo.so",
+		id:       FileID{dev: 0x801, inode: 8},
+		segments: segments{{vaddr: 0x2000, off: 0x1000, size: 0x1000}},
+		dynamic:  true,
+	}
+	// Another executable loaded at the link-time address, which overlaps the other executable.
+	static := &object{
+		path:     "/usr/bin/static",
+		id:       FileID{dev: 0x801, inode: 9},
+		segments: segments{{vaddr: 0x401000, off: 0x1000, size: 0x1000}},
+	}
+	p := &ProcessTranslator{
+		objects:  []*object{executable, library, static},
+		mappings: expirable.NewLRU[uint32, []*procfs.ProcMap](2, nil, 0),
+	}
+	p.mappings.Add(1, []*procfs.ProcMap{
+		{StartAddr: 0x7f0000000000, EndAddr: 0x7f0000001000, Offset: 0, Dev: 0x801, Inode: 42, Pathname: "/app"},
+		{StartAddr: 0x7f0000001000, EndAddr: 0x7f0000003000, Offset: 0x1000, Dev: 0x801, Inode: 42, Pathname: "/app"},
+		{StartAddr: 0x7f0000010000, EndAddr: 0x7f0000011000, Offset: 0x1000, Dev: 0x801, Inode: 7, Pathname: "/lib/libc.so.6"},
+		{StartAddr: 0x7f0000020000, EndAddr: 0x7f0000021000, Offset: 0x1000, Dev: 0x801, Inode: 8, Pathname: "/usr/lib/libgo.so"},
+		// Another file with the same inode number on another device, e.g. in another container.
+		{StartAddr: 0x7f0000030000, EndAddr: 0x7f0000031000, Offset: 0x1000, Dev: 0x802, Inode: 8, Pathname: "/usr/lib/libother.so"},
+	})
+	p.mappings.Add(2, []*procfs.ProcMap{
+		{StartAddr: 0x401000, EndAddr: 0x402000, Offset: 0x1000, Dev: 0x801, Inode: 9, Pathname: "/usr/bin/static"},
+	})
+	tests := []struct {
+		name       string
+		pid        uint32
+		pc         uint64
+		wantObject *object
+		want       uint64
+		wantOk     bool
+	}{
+		{name: "executable", pid: 1, pc: 0x7f0000001234, wantObject: executable, want: 0x1234, wantOk: true},
+		{name: "Go shared object", pid: 1, pc: 0x7f0000020010, wantObject: library, want: 0x2010, wantOk: true},
+		{name: "unknown shared object", pid: 1, pc: 0x7f0000010010, wantOk: false},
+		{name: "same inode on another device", pid: 1, pc: 0x7f0000030010, wantOk: false},
+		{name: "unmapped", pid: 1, pc: 0x1234, wantOk: false},
+		{name: "executable at the link-time address", pid: 2, pc: 0x401234, wantObject: static, want: 0x401234, wantOk: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotObject, got, ok := p.linkTimeAddress(tt.pid, tt.pc)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.wantObject, gotObject)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_ProcessTranslator_linkTimeAddress_exited(t *testing.T) {
+	static := &object{
+		path:     "/usr/bin/static",
+		id:       FileID{dev: 0x801, inode: 9},
+		segments: segments{{vaddr: 0x401000, off: 0x1000, size: 0x1000}},
+	}
+	other := &object{
+		path:     "/usr/bin/other",
+		id:       FileID{dev: 0x801, inode: 10},
+		segments: segments{{vaddr: 0x401000, off: 0x1000, size: 0x2000}},
+	}
+	pie := &object{
+		path:     "/usr/bin/app",
+		id:       FileID{dev: 0x801, inode: 42},
+		segments: segments{{vaddr: 0x401000, off: 0x1000, size: 0x1000}},
+		dynamic:  true,
+	}
+	// The mappings of an exited process cannot be read.
+	const pid = math.MaxInt32
+	tests := []struct {
+		name       string
+		objects    []*object
+		wantObject *object
+		wantOk     bool
+	}{
+		{name: "single executable at the link-time address", objects: []*object{static, pie}, wantObject: static, wantOk: true},
+		{name: "executables at the same link-time address", objects: []*object{static, other}, wantOk: false},
+		{name: "position independent executable", objects: []*object{pie}, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ProcessTranslator{
+				objects:  tt.objects,
+				mappings: expirable.NewLRU[uint32, []*procfs.ProcMap](2, nil, 0),
+			}
+			gotObject, _, ok := p.linkTimeAddress(pid, 0x401234)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.wantObject, gotObject)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package bininfo
+
+import (
+	"debug/elf"
+	"fmt"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+// ReturnOffsets returns the offsets of the RET instructions of the function in the ELF file to attach uprobes.
+// uretprobes must not be attached to functions that run on goroutine stacks since the Go runtime
+// moves the stacks and fails to unwind the return address replaced by the kernel.
+// The function is found in .gopclntab, so it works for stripped executables.
+func ReturnOffsets(path string, symbol string) ([]uint64, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	table, err := newGoSymTable(f)
+	if err != nil {
+		return nil, err
+	}
+	fn := table.LookupFunc(symbol)
+	if fn == nil {
+		return nil, fmt.Errorf("%s is not found in .gopclntab", symbol)
+	}
+	var text *elf.Prog
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_LOAD && prog.Vaddr <= fn.Entry && fn.End <= prog.Vaddr+prog.Filesz {
+			text = prog
+			break
+		}
+	}
+	if text == nil {
+		return nil, fmt.Errorf("%s is not in any segment", symbol)
+	}
+	code := make([]byte, fn.End-fn.Entry)
+	if _, err := text.ReadAt(code, int64(fn.Entry-text.Vaddr)); err != nil {
+		return nil, err
+	}
+	var offsets []uint64
+	for pc := 0; pc < len(code); {
+		inst, err := x86asm.Decode(code[pc:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s at %#x: %w", symbol, fn.Entry+uint64(pc), err)
+		}
+		if inst.Op == x86asm.RET {
+			offsets = append(offsets, fn.Entry+uint64(pc)-text.Vaddr+text.Off)
+		}
+		pc += inst.Len
+	}
+	if len(offsets) == 0 {
+		return nil, fmt.Errorf("no RET instruction in %s", symbol)
+	}
+	return offsets, nil
+}
@@ -0,0 +1,39 @@
+package bininfo
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ReturnOffsets(t *testing.T) {
+	path, err := os.Executable()
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		symbol  string
+		wantErr bool
+	}{
+		{symbol: "runtime.makechan"},
+		{symbol: "sync.runtime_SemacquireRWMutexR"},
+		{symbol: "runtime.noSuchFunction", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.symbol, func(t *testing.T) {
+			offsets, err := ReturnOffsets(path, tt.symbol)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.NotEmpty(t, offsets)
+			for _, off := range offsets {
+				assert.Equal(t, byte(0xc3), data[off], "offset %#x is not RET", off)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package bininfo
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"sync"
+)
+
+// attrGoRuntimeType is DW_AT_go_runtime_type, the address of the runtime type descriptor of a Go type.
+// https://github.com/golang/go/blob/release-branch.go1.23/src/cmd/internal/dwarf/dwarf.go#L337
+const attrGoRuntimeType dwarf.Attr = 0x2904
+
+// TypeNames resolves the names of Go types from the addresses of the runtime type descriptors in processes,
+// such as the *chantype passed to runtime.makechan.
+type TypeNames struct {
+	path    string
+	names   map[uint64]string // keyed by the link-time address
+	dynamic bool
+
+	mu     sync.Mutex
+	biases map[int]uint64 // keyed by pid
+}
+
+// NewTypeNames loads the names of the types that have runtime type descriptors from DWARF.
+func NewTypeNames(path string) (*TypeNames, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d, err := f.DWARF()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint64]string)
+	r := d.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		addr, ok := entry.Val(attrGoRuntimeType).(uint64)
+		if !ok || addr == 0 {
+			continue
+		}
+		if name, ok := entry.Val(dwarf.AttrName).(string); ok {
+			names[addr] = name
+		}
+	}
+	return &TypeNames{
+		path:    path,
+		names:   names,
+		dynamic: f.Type == elf.ET_DYN,
+		biases:  make(map[int]uint64),
+	}, nil
+}
+
+// Name returns the name of the type whose runtime type descriptor is at the address in the process.
+func (t *TypeNames) Name(pid int, addr uint64) (string, bool) {
+	if t.dynamic {
+		bias, err := t.bias(pid)
+		if err != nil {
+			return "", false
+		}
+		addr -= bias
+	}
+	name, ok := t.names[addr]
+	return name, ok
+}
+
+// Forget deletes the cached load address of the process that has exited.
+func (t *TypeNames) Forget(pid int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.biases, pid)
+}
+
+func (t *TypeNames) bias(pid int) (uint64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if bias, ok := t.biases[pid]; ok {
+		return bias, nil
+	}
+	f, err := elf.Open(t.path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	bias, err := loadBias(pid, t.path, f)
+	if err != nil {
+		return 0, err
+	}
+	t.biases[pid] = bias
+	return bias, nil
+}
@@ -0,0 +1,40 @@
+package bininfo
+
+import (
+	"debug/elf"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_TypeNames(t *testing.T) {
+	for _, buildmode := range []string{"exe", "pie"} {
+		t.Run(buildmode, func(t *testing.T) {
+			path, pid := startFixture(t, buildmode)
+			types, err := NewTypeNames(path)
+			require.NoError(t, err)
+			var addr uint64
+			for a, name := range types.names {
+				if name == "chan struct {}" {
+					addr = a
+				}
+			}
+			require.NotZero(t, addr, "the type of the channel in the fixture is not found")
+
+			f, err := elf.Open(path)
+			require.NoError(t, err)
+			defer f.Close()
+			var bias uint64
+			if f.Type == elf.ET_DYN {
+				bias, err = loadBias(pid, path, f)
+				require.NoError(t, err)
+			}
+			name, ok := types.Name(pid, addr+bias)
+			assert.True(t, ok)
+			assert.Equal(t, "chan struct {}", name)
+			_, ok = types.Name(pid, 1)
+			assert.False(t, ok)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package bininfo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// maxWaitReasonLength bounds the length of a wait reason string read from a process.
+const maxWaitReasonLength = 256
+
+// WaitReasons returns the strings of runtime.waitReason indexed by the value.
+// The values differ across Go versions, so the strings are read from runtime.waitReasonStrings of the process.
+// The process memory is read rather than the file since the pointers in the array are relocated at runtime
+// if the executable is position independent.
+func WaitReasons(pid int, path string) ([]string, error) {
+	addr, size, err := processVariable(pid, path, "runtime.waitReasonStrings")
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 || size%16 != 0 {
+		return nil, fmt.Errorf("unexpected size of runtime.waitReasonStrings: %d", size)
+	}
+	mem, err := os.Open(filepath.Join("/proc", strconv.Itoa(pid), "mem"))
+	if err != nil {
+		return nil, err
+	}
+	defer mem.Close()
+
+	// runtime.waitReasonStrings is [...]string.
+	headers := make([]byte, size)
+	if _, err := mem.ReadAt(headers, int64(addr)); err != nil {
+		return nil, fmt.Errorf("failed to read runtime.waitReasonStrings: %w", err)
+	}
+	reasons := make([]string, size/16)
+	for i := range reasons {
+		ptr := binary.LittleEndian.Uint64(headers[16*i:])
+		length := binary.LittleEndian.Uint64(headers[16*i+8:])
+		if length == 0 {
+			continue
+		}
+		if length > maxWaitReasonLength {
+			return nil, fmt.Errorf("wait reason %d is too long: %d", i, length)
+		}
+		b := make([]byte, length)
+		if _, err := mem.ReadAt(b, int64(ptr)); err != nil {
+			return nil, fmt.Errorf("failed to read wait reason %d: %w", i, err)
+		}
+		reasons[i] = string(b)
+	}
+	return reasons, nil
+}
@@ -0,0 +1,22 @@
+package bininfo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WaitReasons(t *testing.T) {
+	for _, buildmode := range []string{"exe", "pie"} {
+		t.Run(buildmode, func(t *testing.T) {
+			path, pid := startFixture(t, buildmode)
+			reasons, err := WaitReasons(pid, path)
+			require.NoError(t, err)
+			// waitReasonZero is the empty string.
+			assert.Equal(t, "", reasons[0])
+			assert.Contains(t, reasons, "chan receive")
+			assert.Contains(t, reasons, "sleep")
+		})
+	}
+}
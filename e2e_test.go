@@ -141,10 +141,13 @@ func evaluateGmonMetrics(t *testing.T) {
 	expectedMetrics := []string{
 		"gmon_goroutine_creation",
 		"gmon_goroutine_exit",
-		"gmon_goroutine_uptime",
+		"gmon_goroutine_lifetime",
+		"gmon_goroutine_age",
+		"gmon_goroutine_live",
 	}
 	// Due to the high cardinality concern, we add up to 5 stack labels to metrics.
 	expectedLabels := map[string]struct{}{
+		"pid":     {},
 		"stack_0": {},
 		"stack_1": {},
 		"stack_2": {},
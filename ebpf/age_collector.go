@@ -0,0 +1,75 @@
+package ebpf
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ageCollector computes the age distribution of the live goroutines on each scrape.
+// Unlike the lifetime histogram, a goroutine is counted once per scrape as long as it is alive.
+// The buckets are exported as gauges since they go down when goroutines exit, which a histogram would expose as counter resets.
+type ageCollector struct {
+	liveGoroutines func() []goroutine
+	metrics        *metrics
+	buckets        []float64
+	desc           *prometheus.Desc
+}
+
+func newAgeCollector(liveGoroutines func() []goroutine, metrics *metrics, buckets []float64) *ageCollector {
+	return &ageCollector{
+		liveGoroutines: liveGoroutines,
+		metrics:        metrics,
+		buckets:        append(append([]float64{}, buckets...), math.Inf(1)),
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "goroutine_age"),
+			"The number of live goroutines whose age in seconds is less than or equal to le",
+			append(append([]string{}, metrics.labelKeys...), "le"),
+			nil,
+		),
+	}
+}
+
+func (c *ageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *ageCollector) Collect(ch chan<- prometheus.Metric) {
+	type ageBuckets struct {
+		labelValues []string
+		counts      []uint64
+	}
+	groups := make(map[string]*ageBuckets)
+	var order []string
+	now := time.Now()
+	for _, g := range c.liveGoroutines() {
+		labels := c.metrics.goroutineLabels(g)
+		labelValues := make([]string, len(c.metrics.labelKeys))
+		for i, k := range c.metrics.labelKeys {
+			labelValues[i] = labels[k]
+		}
+		key := strings.Join(labelValues, "\xff")
+		b, ok := groups[key]
+		if !ok {
+			b = &ageBuckets{labelValues: labelValues, counts: make([]uint64, len(c.buckets))}
+			groups[key] = b
+			order = append(order, key)
+		}
+		age := now.Sub(g.ObservedAt).Seconds()
+		for i, upperBound := range c.buckets {
+			if age <= upperBound {
+				b.counts[i]++
+			}
+		}
+	}
+	for _, key := range order {
+		b := groups[key]
+		for i, upperBound := range c.buckets {
+			le := strconv.FormatFloat(upperBound, 'g', -1, 64)
+			ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(b.counts[i]), append(b.labelValues, le)...)
+		}
+	}
+}
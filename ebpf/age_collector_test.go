@@ -0,0 +1,49 @@
+package ebpf
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ageCollector_Collect(t *testing.T) {
+	stack := []location{{Function: "runtime.newproc"}, {Function: "main.main"}}
+	tests := []struct {
+		name       string
+		goroutines []goroutine
+		want       string
+	}{
+		{
+			name: "no live goroutines",
+		},
+		{
+			name: "goroutines are counted in the buckets of their age",
+			goroutines: []goroutine{
+				{Id: 1, Pid: 100, Stack: stack, ObservedAt: time.Now()},
+				{Id: 2, Pid: 100, Stack: stack, ObservedAt: time.Now().Add(-5 * time.Second)},
+				{Id: 3, Pid: 100, Stack: stack, ObservedAt: time.Now().Add(-time.Minute)},
+				{Id: 1, Pid: 200, Stack: stack, ObservedAt: time.Now().Add(-5 * time.Second)},
+			},
+			want: `
+# HELP gmon_goroutine_age The number of live goroutines whose age in seconds is less than or equal to le
+# TYPE gmon_goroutine_age gauge
+gmon_goroutine_age{le="1",pid="100",stack_0="main.main",stack_1="runtime.newproc",stack_2="none",stack_3="none",stack_4="none"} 1
+gmon_goroutine_age{le="10",pid="100",stack_0="main.main",stack_1="runtime.newproc",stack_2="none",stack_3="none",stack_4="none"} 2
+gmon_goroutine_age{le="+Inf",pid="100",stack_0="main.main",stack_1="runtime.newproc",stack_2="none",stack_3="none",stack_4="none"} 3
+gmon_goroutine_age{le="1",pid="200",stack_0="main.main",stack_1="runtime.newproc",stack_2="none",stack_3="none",stack_4="none"} 0
+gmon_goroutine_age{le="10",pid="200",stack_0="main.main",stack_1="runtime.newproc",stack_2="none",stack_3="none",stack_4="none"} 1
+gmon_goroutine_age{le="+Inf",pid="200",stack_0="main.main",stack_1="runtime.newproc",stack_2="none",stack_3="none",stack_4="none"} 1
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := newTestMetrics(t, Config{})
+			c := newAgeCollector(func() []goroutine { return tt.goroutines }, metrics, []float64{1, 10})
+			assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(tt.want)))
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package ebpf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTopLimit is the number of entries served by the top N APIs without ?limit=.
+const defaultTopLimit = 10
+
+// goroutineView is the JSON representation of a live goroutine.
+type goroutineView struct {
+	Pid        uint32    `json:"pid"`
+	Ppid       uint32    `json:"ppid,omitempty"`
+	Id         int64     `json:"goroutine_id"`
+	ParentId   int64     `json:"parent_goroutine_id"`
+	ObservedAt time.Time `json:"observed_at"`
+	// ObservedAtMonotonicNs is the CLOCK_MONOTONIC nanoseconds of ObservedAt, comparable with the kernel clock.
+	ObservedAtMonotonicNs uint64 `json:"observed_at_monotonic_ns"`
+	Preexisting           bool   `json:"preexisting,omitempty"`
+	// ChannelBlockedSeconds is the total time that the goroutine was blocked on channels, reported with -channels.
+	ChannelBlockedSeconds float64 `json:"channel_blocked_seconds,omitempty"`
+	// SchedLatency is the time that the goroutine was runnable until it got a P, reported with -sched-latency.
+	SchedLatency  *schedLatencyView `json:"sched_latency,omitempty"`
+	CreatedBy     *locationView     `json:"created_by,omitempty"`
+	StartFunction *locationView     `json:"start_function,omitempty"`
+	Stack         []*locationView   `json:"stack"`
+	Children      []*goroutineView  `json:"children,omitempty"`
+}
+
+// locationView is the JSON representation of a symbolized program counter.
+type locationView struct {
+	PC       string `json:"pc"`
+	Function string `json:"function"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Inlined  bool   `json:"inlined,omitempty"`
+}
+
+func newStackView(stack []location) []*locationView {
+	views := make([]*locationView, len(stack))
+	for i, l := range stack {
+		views[i] = newLocationView(l)
+	}
+	return views
+}
+
+func newLocationView(l location) *locationView {
+	if l.PC == 0 {
+		return nil
+	}
+	return &locationView{
+		PC:       fmt.Sprintf("%#x", l.PC),
+		Function: l.Function,
+		File:     l.File,
+		Line:     l.Line,
+		Inlined:  l.Inlined,
+	}
+}
+
+func newGoroutineView(g goroutine) *goroutineView {
+	var channelBlocked time.Duration
+	if g.channelBlocked != nil {
+		channelBlocked = time.Duration(g.channelBlocked.Load())
+	}
+	return &goroutineView{
+		Pid:                   g.Pid,
+		Ppid:                  g.Ppid,
+		Id:                    g.Id,
+		ParentId:              g.ParentId,
+		ObservedAt:            g.ObservedAt,
+		ObservedAtMonotonicNs: g.Ktime,
+		Preexisting:           g.Preexisting,
+		ChannelBlockedSeconds: channelBlocked.Seconds(),
+		SchedLatency:          newSchedLatencyView(g.schedLatency),
+		CreatedBy:             newLocationView(g.CreatedBy),
+		StartFunction:         newLocationView(g.StartFunction),
+		Stack:                 newStackView(g.Stack),
+	}
+}
+
+// liveGoroutines returns the goroutines that have been created and not exited yet, ordered by pid and goroutine id.
+func (r *reporter) liveGoroutines() []goroutine {
+	var gs []goroutine
+	r.goroutineMap.Range(func(_, value any) bool {
+		gs = append(gs, value.(goroutine))
+		return true
+	})
+	sort.Slice(gs, func(i, j int) bool {
+		if gs[i].Pid != gs[j].Pid {
+			return gs[i].Pid < gs[j].Pid
+		}
+		return gs[i].Id < gs[j].Id
+	})
+	return gs
+}
+
+// serveGoroutines serves the live goroutines as JSON.
+func (r *reporter) serveGoroutines(w http.ResponseWriter, _ *http.Request) {
+	gs := r.liveGoroutines()
+	views := make([]*goroutineView, len(gs))
+	for i := range gs {
+		views[i] = newGoroutineView(gs[i])
+	}
+	writeJSON(w, views)
+}
+
+// serveGoroutineTree serves the ancestry tree of the live goroutines.
+// The tree is rendered as JSON by default, or as Graphviz DOT with ?format=dot.
+func (r *reporter) serveGoroutineTree(w http.ResponseWriter, req *http.Request) {
+	roots := goroutineTree(r.liveGoroutines())
+	switch format := req.URL.Query().Get("format"); format {
+	case "", "json":
+		writeJSON(w, roots)
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		writeDOT(w, roots)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported format %q", format), http.StatusBadRequest)
+	}
+}
+
+// leakSuspectView is the JSON representation of a creation site that is suspected to leak goroutines.
+type leakSuspectView struct {
+	Pid              uint32          `json:"pid"`
+	Stack            []*locationView `json:"stack"`
+	Reason           string          `json:"reason"`
+	Live             int             `json:"live"`
+	Suspected        int             `json:"suspected"`
+	OldestAgeSeconds float64         `json:"oldest_age_seconds"`
+	ThresholdSeconds float64         `json:"threshold_seconds"`
+}
+
+func newLeakSuspectView(s leakSuspect) leakSuspectView {
+	return leakSuspectView{
+		Pid:              s.site.pid,
+		Stack:            newStackView(s.oldest.Stack),
+		Reason:           s.reason,
+		Live:             s.live,
+		Suspected:        s.suspected,
+		OldestAgeSeconds: s.oldestAge.Seconds(),
+		ThresholdSeconds: s.threshold.Seconds(),
+	}
+}
+
+// serveLeakSuspects serves the creation sites that are suspected to leak goroutines as JSON.
+func (d *leakDetector) serveLeakSuspects(w http.ResponseWriter, _ *http.Request) {
+	suspects := d.leakSuspects()
+	views := make([]leakSuspectView, len(suspects))
+	for i, s := range suspects {
+		views[i] = newLeakSuspectView(s)
+	}
+	writeJSON(w, views)
+}
+
+// serveChannels serves the channels that goroutines were blocked on the longest as JSON.
+// The number of channels is limited by ?limit=.
+func (a *channelAnalyzer) serveChannels(w http.ResponseWriter, req *http.Request) {
+	limit, err := limitParam(req, defaultTopLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, a.topChannels(limit))
+}
+
+// serveLocks serves the locks that goroutines waited for the longest as JSON.
+// The number of locks is limited by ?limit=.
+func (h *lockHandler) serveLocks(w http.ResponseWriter, req *http.Request) {
+	limit, err := limitParam(req, defaultTopLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, h.topLocks(limit))
+}
+
+// serveSlowestScheduled serves the live goroutines that waited the longest for a P as JSON.
+// The number of goroutines is limited by ?limit=.
+func (r *reporter) serveSlowestScheduled(w http.ResponseWriter, req *http.Request) {
+	limit, err := limitParam(req, defaultTopLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	gs := slowestScheduled(r.liveGoroutines(), limit)
+	views := make([]*goroutineView, len(gs))
+	for i := range gs {
+		views[i] = newGoroutineView(gs[i])
+	}
+	writeJSON(w, views)
+}
+
+// limitParam returns the positive integer of ?limit=, or defaultLimit if it is not given.
+func limitParam(req *http.Request, defaultLimit int) (int, error) {
+	v := req.URL.Query().Get("limit")
+	if v == "" {
+		return defaultLimit, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid limit %q", v)
+	}
+	return n, nil
+}
+
+// goroutineTree builds the ancestry tree of the given goroutines.
+// A goroutine whose parent is not in gs becomes a root.
+func goroutineTree(gs []goroutine) []*goroutineView {
+	views := make(map[goroutineKey]*goroutineView, len(gs))
+	for _, g := range gs {
+		views[g.key()] = newGoroutineView(g)
+	}
+	var roots []*goroutineView
+	for _, g := range gs {
+		view := views[g.key()]
+		parent, ok := views[goroutineKey{pid: g.Pid, goid: g.ParentId}]
+		if !ok || g.ParentId == 0 {
+			roots = append(roots, view)
+			continue
+		}
+		parent.Children = append(parent.Children, view)
+	}
+	return roots
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("Failed to write JSON response", slog.Any("error", err))
+	}
+}
+
+func writeDOT(w io.Writer, roots []*goroutineView) {
+	fmt.Fprintln(w, "digraph goroutines {")
+	fmt.Fprintln(w, "  node [shape=box];")
+	var walk func(v *goroutineView)
+	walk = func(v *goroutineView) {
+		label := fmt.Sprintf("pid %d\ngoroutine %d", v.Pid, v.Id)
+		if v.StartFunction != nil {
+			label += "\n" + v.StartFunction.Function
+		}
+		if v.CreatedBy != nil {
+			label += "\ncreated by " + v.CreatedBy.Function
+		} else {
+			for _, l := range v.Stack {
+				// Skip the frames of runtime.newproc to show where the goroutine is created.
+				if !strings.HasPrefix(l.Function, "runtime.") {
+					label += "\ncreated by " + l.Function
+					break
+				}
+			}
+		}
+		fmt.Fprintf(w, "  %q [label=%q];\n", dotNodeId(v.Pid, v.Id), label)
+		for _, c := range v.Children {
+			fmt.Fprintf(w, "  %q -> %q;\n", dotNodeId(v.Pid, v.Id), dotNodeId(c.Pid, c.Id))
+			walk(c)
+		}
+	}
+	for _, root := range roots {
+		if root.ParentId != 0 {
+			// The parent has already exited or was created before gmon started.
+			fmt.Fprintf(w, "  %q [label=%q, style=dashed];\n", dotNodeId(root.Pid, root.ParentId), fmt.Sprintf("pid %d\ngoroutine %d", root.Pid, root.ParentId))
+			fmt.Fprintf(w, "  %q -> %q;\n", dotNodeId(root.Pid, root.ParentId), dotNodeId(root.Pid, root.Id))
+		}
+		walk(root)
+	}
+	fmt.Fprintln(w, "}")
+}
+
+func dotNodeId(pid uint32, goid int64) string {
+	return fmt.Sprintf("%d/%d", pid, goid)
+}
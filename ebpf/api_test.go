@@ -0,0 +1,29 @@
+package ebpf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_goroutineTree(t *testing.T) {
+	gs := []goroutine{
+		{Pid: 1, Id: 1},
+		{Pid: 1, Id: 2, ParentId: 1},
+		{Pid: 1, Id: 3, ParentId: 2},
+		{Pid: 1, Id: 4, ParentId: 1},
+		{Pid: 1, Id: 5, ParentId: 99}, // the parent has exited
+		{Pid: 2, Id: 2, ParentId: 1},  // the same goroutine id in another process
+	}
+	want := []*goroutineView{
+		{Pid: 1, Id: 1, Stack: []*locationView{}, Children: []*goroutineView{
+			{Pid: 1, Id: 2, ParentId: 1, Stack: []*locationView{}, Children: []*goroutineView{
+				{Pid: 1, Id: 3, ParentId: 2, Stack: []*locationView{}},
+			}},
+			{Pid: 1, Id: 4, ParentId: 1, Stack: []*locationView{}},
+		}},
+		{Pid: 1, Id: 5, ParentId: 99, Stack: []*locationView{}},
+		{Pid: 2, Id: 2, ParentId: 1, Stack: []*locationView{}},
+	}
+	assert.Equal(t, want, goroutineTree(gs))
+}
@@ -0,0 +1,487 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/keisku/gmon/bininfo"
+)
+
+// attacher attaches the eBPF programs to targets and detaches them.
+// The programs are loaded per layout of runtime.g since the offsets are constants.
+// All collections share the maps of the first one to read events from a single ring buffer.
+type attacher struct {
+	processTranslator *bininfo.ProcessTranslator
+	waitReasons       bool // attach the probes for park and unpark events
+	channels          bool // attach the probes for channel operations and park and unpark events
+	locks             bool // attach the probes for the slow paths of sync.Mutex and sync.RWMutex
+	schedLatency      bool // attach the probes for runnable goroutines and runtime.execute
+
+	mu          sync.Mutex
+	collections map[bininfo.GLayout]*bpfObjects
+	shared      *bpfObjects
+	objects     map[bininfo.FileID]*goObject
+	hosts       map[bininfo.FileID]int // the number of the attached targets whose executable loads a Go shared object
+	attachments map[Target]attachment
+}
+
+// attachment is the uprobes attached to a target and the objects that the target holds.
+type attachment struct {
+	links  []link.Link
+	object bininfo.FileID
+	host   bininfo.FileID // the zero value unless the executable loads a Go shared object
+}
+
+// goObject is a Go executable or shared object that the attached targets run.
+// Processes reach the same file through different paths, e.g. /proc/<pid>/root of each container,
+// so the information loaded from the file is shared by the file identity until all targets running it are detached.
+type goObject struct {
+	translator bininfo.Translator
+	layout     bininfo.GLayout
+	targets    int
+
+	mu            sync.Mutex
+	reasons       []string // nil if the strings are unknown
+	reasonsRead   bool
+	typeNames     *bininfo.TypeNames // nil if DWARF is unavailable
+	typeNamesRead bool
+}
+
+func newGoObject(path string) (*goObject, error) {
+	layout, err := bininfo.NewGLayout(path)
+	if err != nil {
+		return nil, err
+	}
+	translator, err := bininfo.NewTranslator(path)
+	if err != nil {
+		return nil, err
+	}
+	return &goObject{translator: translator, layout: layout}, nil
+}
+
+// waitReasons returns the strings of runtime.waitReason, which are read from the process at the first call.
+func (o *goObject) waitReasons(pid int, path string) []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.reasonsRead {
+		reasons, err := bininfo.WaitReasons(pid, path)
+		if err != nil {
+			slog.Warn("Failed to read wait reasons", slog.String("path", path), slog.Any("error", err))
+		}
+		o.reasons = reasons
+		o.reasonsRead = true
+	}
+	return o.reasons
+}
+
+// typeName returns the name of the type whose runtime type descriptor is at the address in the process.
+// The type names are read from DWARF at the first call.
+func (o *goObject) typeName(pid int, path string, addr uint64) (string, bool) {
+	o.mu.Lock()
+	if !o.typeNamesRead {
+		names, err := bininfo.NewTypeNames(path)
+		if err != nil {
+			slog.Warn("Failed to read type names", slog.String("path", path), slog.Any("error", err))
+		}
+		o.typeNames = names
+		o.typeNamesRead = true
+	}
+	names := o.typeNames
+	o.mu.Unlock()
+	if names == nil {
+		return "", false
+	}
+	return names.Name(pid, addr)
+}
+
+// forget deletes the information cached for the process that has exited.
+func (o *goObject) forget(pid int) {
+	o.mu.Lock()
+	names := o.typeNames
+	o.mu.Unlock()
+	if names != nil {
+		names.Forget(pid)
+	}
+}
+
+func newAttacher(config Config) *attacher {
+	return &attacher{
+		processTranslator: bininfo.NewProcessTranslator(),
+		waitReasons:       config.waitReasons,
+		channels:          config.channels,
+		locks:             config.locks,
+		schedLatency:      config.schedLatency,
+		collections:       make(map[bininfo.GLayout]*bpfObjects),
+		objects:           make(map[bininfo.FileID]*goObject),
+		hosts:             make(map[bininfo.FileID]int),
+		attachments:       make(map[Target]attachment),
+	}
+}
+
+// sharedObjects returns the collection whose maps are shared by the others.
+// It is loaded for the layout only if no collection is loaded yet, e.g. in the daemon mode without targets at startup.
+func (a *attacher) sharedObjects(layout bininfo.GLayout) (*bpfObjects, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.shared != nil {
+		return a.shared, nil
+	}
+	return a.collection(layout)
+}
+
+// collection returns the collection for the layout. The caller must hold a.mu.
+func (a *attacher) collection(layout bininfo.GLayout) (*bpfObjects, error) {
+	if objs, ok := a.collections[layout]; ok {
+		return objs, nil
+	}
+	objs, err := loadCollection(layout, a.shared)
+	if err != nil {
+		return nil, err
+	}
+	a.collections[layout] = objs
+	if a.shared == nil {
+		a.shared = objs
+	}
+	return objs, nil
+}
+
+// attach attaches the eBPF programs to the Go runtime of the target.
+func (a *attacher) attach(target Target) error {
+	id, err := bininfo.StatFileID(target.goObjectPath)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.attachments[target]; ok {
+		return nil
+	}
+	object, ok := a.objects[id]
+	if !ok {
+		object, err = newGoObject(target.goObjectPath)
+		if err != nil {
+			return err
+		}
+	}
+	objs, err := a.collection(object.layout)
+	if err != nil {
+		return err
+	}
+	links, err := attachTarget(target, objs, object.translator, probeOptions{
+		park:         a.waitReasons || a.channels,
+		channels:     a.channels,
+		locks:        a.locks,
+		schedLatency: a.schedLatency,
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := a.processTranslator.AddObject(target.goObjectPath, object.translator); err != nil {
+			closeLinks(links)
+			return err
+		}
+		a.objects[id] = object
+	}
+	object.targets++
+	a.attachments[target] = attachment{
+		links:  links,
+		object: id,
+		host:   a.addHost(target),
+	}
+	slog.Debug("attached uprobes", slog.String("target", target.String()))
+	return nil
+}
+
+// addHost adds the executable of the target if the Go runtime lives in a shared object loaded by it.
+// It returns the identity of the executable, or the zero value if it is not added.
+func (a *attacher) addHost(target Target) bininfo.FileID {
+	if target.binPath == target.goObjectPath {
+		return bininfo.FileID{}
+	}
+	id, err := bininfo.StatFileID(target.binPath)
+	if err != nil {
+		slog.Debug("failed to stat the executable", slog.Any("error", err))
+		return bininfo.FileID{}
+	}
+	if a.hosts[id] == 0 && !addHostObject(a.processTranslator, target) {
+		return bininfo.FileID{}
+	}
+	a.hosts[id]++
+	return id
+}
+
+// detach detaches the eBPF programs from the targets of the pid.
+// The objects are evicted when no targets run them anymore.
+func (a *attacher) detach(pid int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for target, attachment := range a.attachments {
+		if target.pid != pid {
+			continue
+		}
+		for _, l := range attachment.links {
+			if err := l.Close(); err != nil {
+				slog.Warn("Failed to close link", slog.Any("error", err))
+			}
+		}
+		delete(a.attachments, target)
+		a.release(attachment)
+		slog.Debug("detached uprobes", slog.String("target", target.String()))
+	}
+	// The process may run the executable of a target without pid.
+	for _, object := range a.objects {
+		object.forget(pid)
+	}
+}
+
+// release evicts the objects of the detached target if no other targets hold them. The caller must hold a.mu.
+func (a *attacher) release(attachment attachment) {
+	if object, ok := a.objects[attachment.object]; ok {
+		object.targets--
+		if object.targets == 0 {
+			delete(a.objects, attachment.object)
+			a.processTranslator.RemoveObject(attachment.object)
+		}
+	}
+	if attachment.host == (bininfo.FileID{}) {
+		return
+	}
+	a.hosts[attachment.host]--
+	if a.hosts[attachment.host] == 0 {
+		delete(a.hosts, attachment.host)
+		a.processTranslator.RemoveObject(attachment.host)
+	}
+}
+
+// goObject returns the Go object of the process and the path to it if the process is monitored.
+// Processes running the executable of a target without pid are also monitored.
+func (a *attacher) goObject(pid int) (*goObject, string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var found *goObject
+	var path string
+	for target, attachment := range a.attachments {
+		if target.pid == pid {
+			return a.objects[attachment.object], target.goObjectPath, true
+		}
+		if target.pid == 0 {
+			found, path = a.objects[attachment.object], target.goObjectPath
+		}
+	}
+	return found, path, found != nil
+}
+
+func (a *attacher) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var errs []error
+	for target, attachment := range a.attachments {
+		for _, l := range attachment.links {
+			errs = append(errs, l.Close())
+		}
+		delete(a.attachments, target)
+	}
+	for layout, objs := range a.collections {
+		errs = append(errs, objs.Close())
+		delete(a.collections, layout)
+	}
+	return errors.Join(errs...)
+}
+
+// loadCollection loads the eBPF programs for the layout of runtime.g.
+// The maps of shared are reused if it is not nil.
+func loadCollection(layout bininfo.GLayout, shared *bpfObjects) (*bpfObjects, error) {
+	spec, err := loadBpf()
+	if err != nil {
+		return nil, err
+	}
+	if err := spec.RewriteConstants(map[string]interface{}{
+		"g_goid_offset":    layout.Goid,
+		"g_gopc_offset":    layout.Gopc,
+		"g_startpc_offset": layout.Startpc,
+		"g_param_offset":   layout.Param,
+		"sudog_c_offset":   layout.SudogC,
+	}); err != nil {
+		return nil, err
+	}
+	var opts ebpf.CollectionOptions
+	if shared != nil {
+		opts.MapReplacements = map[string]*ebpf.Map{
+			"channel_stacks":       shared.ChannelStacks,
+			"channels":             shared.Channels,
+			"events":               shared.Events,
+			"lock_events":          shared.LockEvents,
+			"panic_events":         shared.PanicEvents,
+			"parent_goroutine_ids": shared.ParentGoroutineIds,
+			"parked_goroutines":    shared.ParkedGoroutines,
+			"pending_chan_ops":     shared.PendingChanOps,
+			"pending_channels":     shared.PendingChannels,
+			"pending_locks":        shared.PendingLocks,
+			"process_events":       shared.ProcessEvents,
+			"runnable_goroutines":  shared.RunnableGoroutines,
+			"sched_events":         shared.SchedEvents,
+			"stack_addresses":      shared.StackAddresses,
+			"wait_events":          shared.WaitEvents,
+		}
+	}
+	objs := &bpfObjects{}
+	if err := spec.LoadAndAssign(objs, &opts); err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
+
+// probe is an eBPF program attached to a function of the Go runtime.
+type probe struct {
+	program *ebpf.Program
+	symbol  string
+	ret     bool
+	// returns attaches the program to the RET instructions of the function instead of a uretprobe,
+	// which must not be used for functions that run on goroutine stacks.
+	returns bool
+	// optional skips the probe if the function is not linked into the executable.
+	optional bool
+}
+
+// probeOptions selects the optional probes to attach.
+type probeOptions struct {
+	park         bool // park and unpark events
+	channels     bool // channel operations
+	locks        bool // the slow paths of sync.Mutex and sync.RWMutex
+	schedLatency bool // runnable goroutines and runtime.execute
+}
+
+// attachTarget attaches the uprobes to the Go runtime of the target.
+func attachTarget(target Target, objs *bpfObjects, translator bininfo.Translator, options probeOptions) ([]link.Link, error) {
+	ex, err := link.OpenExecutable(target.goObjectPath)
+	if err != nil {
+		return nil, err
+	}
+	probes := []probe{
+		{program: objs.RuntimeNewproc1, symbol: "runtime.newproc1", ret: true},
+		{program: objs.RuntimeNewproc1Entry, symbol: "runtime.newproc1", ret: false},
+		{program: objs.RuntimeGoexit1, symbol: "runtime.goexit1", ret: false},
+		{program: objs.RuntimeGopanic, symbol: "runtime.gopanic", ret: false},
+		{program: objs.RuntimeFatalpanic, symbol: "runtime.fatalpanic", ret: false},
+		// runtime.gorecover is not linked if the executable never calls recover.
+		{program: objs.RuntimeGorecoverRet, symbol: "runtime.gorecover", returns: true, optional: true},
+	}
+	if options.park {
+		probes = append(probes,
+			probe{program: objs.RuntimeGopark, symbol: "runtime.gopark", ret: false},
+			probe{program: objs.RuntimeCasgstatus, symbol: "runtime.casgstatus", ret: false},
+		)
+	}
+	if options.channels {
+		probes = append(probes,
+			probe{program: objs.RuntimeChansend, symbol: "runtime.chansend", ret: false},
+			probe{program: objs.RuntimeChanOpRet, symbol: "runtime.chansend", returns: true},
+			probe{program: objs.RuntimeChanrecv, symbol: "runtime.chanrecv", ret: false},
+			probe{program: objs.RuntimeChanOpRet, symbol: "runtime.chanrecv", returns: true},
+			probe{program: objs.RuntimeSelectgo, symbol: "runtime.selectgo", ret: false},
+			probe{program: objs.RuntimeChanOpRet, symbol: "runtime.selectgo", returns: true},
+			probe{program: objs.RuntimeMakechan, symbol: "runtime.makechan", ret: false},
+			probe{program: objs.RuntimeMakechanRet, symbol: "runtime.makechan", returns: true},
+		)
+	}
+	if options.locks {
+		// sync.Mutex wraps internal/sync.Mutex since Go 1.24.
+		lockSlow := firstSymbol(translator, "internal/sync.(*Mutex).lockSlow", "sync.(*Mutex).lockSlow")
+		unlockSlow := firstSymbol(translator, "internal/sync.(*Mutex).unlockSlow", "sync.(*Mutex).unlockSlow")
+		// The functions are not linked if the executable does not use the locks.
+		probes = append(probes,
+			probe{program: objs.SyncMutexLockSlow, symbol: lockSlow, optional: true},
+			probe{program: objs.SyncLockAcquired, symbol: lockSlow, returns: true, optional: true},
+			probe{program: objs.SyncMutexUnlockSlow, symbol: unlockSlow, optional: true},
+			probe{program: objs.SyncSemacquireRwmutexR, symbol: "sync.runtime_SemacquireRWMutexR", optional: true},
+			probe{program: objs.SyncLockAcquired, symbol: "sync.runtime_SemacquireRWMutexR", returns: true, optional: true},
+			probe{program: objs.SyncSemacquireRwmutex, symbol: "sync.runtime_SemacquireRWMutex", optional: true},
+			probe{program: objs.SyncLockAcquired, symbol: "sync.runtime_SemacquireRWMutex", returns: true, optional: true},
+			probe{program: objs.SyncRwmutexRunlockSlow, symbol: "sync.(*RWMutex).rUnlockSlow", optional: true},
+		)
+	}
+	if options.schedLatency {
+		probes = append(probes,
+			probe{program: objs.RuntimeCasgstatusRunnable, symbol: "runtime.casgstatus", ret: false},
+			probe{program: objs.RuntimeExecute, symbol: "runtime.execute", ret: false},
+		)
+	}
+	links := make([]link.Link, 0, len(probes))
+	for _, p := range probes {
+		if p.optional && (p.symbol == "" || translator.Address(p.symbol) == 0) {
+			slog.Debug("skip the uprobe for the function that is not linked", slog.String("symbol", p.symbol))
+			continue
+		}
+		if p.returns {
+			ls, err := linkReturns(ex, p.program, p.symbol, target)
+			if err != nil {
+				closeLinks(links)
+				return nil, err
+			}
+			links = append(links, ls...)
+			continue
+		}
+		l, err := linkUprobe(ex, p.program, p.symbol, p.ret, target.pid, translator.Address)
+		if err != nil {
+			closeLinks(links)
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, nil
+}
+
+// linkReturns attaches the program to the RET instructions of the function.
+func linkReturns(ex *link.Executable, program *ebpf.Program, symbol string, target Target) ([]link.Link, error) {
+	offsets, err := bininfo.ReturnOffsets(target.goObjectPath, symbol)
+	if err != nil {
+		return nil, err
+	}
+	links := make([]link.Link, 0, len(offsets))
+	for _, offset := range offsets {
+		l, err := ex.Uprobe(symbol, program, &link.UprobeOptions{PID: target.pid, Address: offset})
+		if err != nil {
+			closeLinks(links)
+			return nil, fmt.Errorf("failed to attach uprobe for %s at %#x: %w", symbol, offset, err)
+		}
+		links = append(links, l)
+	}
+	return links, nil
+}
+
+func closeLinks(links []link.Link) {
+	for _, l := range links {
+		l.Close()
+	}
+}
+
+// firstSymbol returns the first symbol that is found in the executable, or an empty string if none is found.
+func firstSymbol(translator bininfo.Translator, symbols ...string) string {
+	for _, symbol := range symbols {
+		if translator.Address(symbol) != 0 {
+			return symbol
+		}
+	}
+	return ""
+}
+
+// addHostObject adds the executable that loads the Go shared object of the target.
+// The executable is symbolized on a best-effort basis, so it reports whether the executable is added.
+func addHostObject(p *bininfo.ProcessTranslator, target Target) bool {
+	slog.Info("monitor the Go shared object", slog.String("executable", target.binPath), slog.String("shared_object", target.goObjectPath))
+	hostTranslator, err := bininfo.NewTranslator(target.binPath)
+	if err != nil {
+		slog.Debug("failed to load symbols of the executable", slog.Any("error", err))
+		return false
+	}
+	if err := p.AddObject(target.binPath, hostTranslator); err != nil {
+		slog.Debug("failed to add the executable", slog.Any("error", err))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package ebpf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cilium/ebpf/link"
+	"github.com/keisku/gmon/bininfo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testFileID returns the identity of a new file since FileID is only created from files.
+func testFileID(t *testing.T) bininfo.FileID {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "object")
+	require.NoError(t, os.WriteFile(path, nil, 0o644))
+	id, err := bininfo.StatFileID(path)
+	require.NoError(t, err)
+	return id
+}
+
+func Test_attacher_detach(t *testing.T) {
+	server, library := testFileID(t), testFileID(t)
+	host := testFileID(t)
+	a := newAttacher(Config{})
+	// Two containers run the same executable through different paths.
+	first := Target{binPath: "/proc/100/root/usr/bin/server", goObjectPath: "/proc/100/root/usr/bin/server", pid: 100}
+	second := Target{binPath: "/proc/200/root/usr/bin/server", goObjectPath: "/proc/200/root/usr/bin/server", pid: 200}
+	shared := Target{binPath: "/usr/bin/python3", goObjectPath: "/usr/lib/libgo.so", pid: 300}
+	a.attachments[first] = attachment{links: []link.Link{}, object: server}
+	a.attachments[second] = attachment{links: []link.Link{}, object: server}
+	a.attachments[shared] = attachment{links: []link.Link{}, object: library, host: host}
+	a.objects[server] = &goObject{targets: 2, layout: bininfo.GLayout{Goid: 152}}
+	a.objects[library] = &goObject{targets: 1, layout: bininfo.GLayout{Goid: 160}}
+	a.hosts[host] = 1
+
+	object, path, ok := a.goObject(200)
+	require.True(t, ok)
+	assert.Equal(t, second.goObjectPath, path)
+	assert.Equal(t, uint64(152), object.layout.Goid)
+
+	a.detach(100)
+	assert.Contains(t, a.objects, server, "the object is still run by the other process")
+	object, path, ok = a.goObject(200)
+	require.True(t, ok)
+	assert.Equal(t, second.goObjectPath, path)
+	assert.Same(t, a.objects[server], object)
+
+	a.detach(200)
+	assert.NotContains(t, a.objects, server)
+	_, _, ok = a.goObject(200)
+	assert.False(t, ok)
+
+	a.detach(300)
+	assert.Empty(t, a.objects)
+	assert.Empty(t, a.hosts)
+	assert.Empty(t, a.attachments)
+}
+
+func Test_attacher_goObject_withoutPid(t *testing.T) {
+	server := testFileID(t)
+	a := newAttacher(Config{})
+	a.attachments[Target{binPath: "/usr/bin/server", goObjectPath: "/usr/bin/server"}] = attachment{object: server}
+	a.objects[server] = &goObject{targets: 1}
+
+	// Processes running the executable of a target without pid are monitored.
+	object, path, ok := a.goObject(100)
+	require.True(t, ok)
+	assert.Equal(t, "/usr/bin/server", path)
+	assert.Same(t, a.objects[server], object)
+	// Detaching a process does not detach the target without pid.
+	a.detach(100)
+	assert.Contains(t, a.objects, server)
+}
+
+func Test_attacher_sharedObjects(t *testing.T) {
+	a := newAttacher(Config{})
+	shared := &bpfObjects{}
+	a.collections[bininfo.GLayout{Goid: 152}] = shared
+	a.shared = shared
+
+	// No collection is loaded for another layout.
+	got, err := a.sharedObjects(bininfo.GLayout{})
+	require.NoError(t, err)
+	assert.Same(t, shared, got)
+	assert.Len(t, a.collections, 1)
+}
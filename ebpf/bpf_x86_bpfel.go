@@ -12,15 +12,85 @@ import (
 	"github.com/cilium/ebpf"
 )
 
+type bpfChannel struct {
+	Chantype uint64
+	StackId  int32
+	_        [4]byte
+}
+
+type bpfChannelKey struct {
+	Pid  uint32
+	_    [4]byte
+	Chan uint64
+}
+
 type bpfEvent struct {
+	GoroutineId       int64
+	ParentGoroutineId int64
+	Gopc              uint64
+	Startpc           uint64
+	Ktime             uint64
+	StackId           int32
+	Pid               uint32
+	Exit              bool
+	_                 [7]byte
+}
+
+type bpfLockEvent struct {
 	GoroutineId int64
+	DurationNs  uint64
+	Lock        uint64
+	Pid         uint32
 	StackId     int32
-	Exit        bool
+	Op          uint8
+	_           [7]byte
+}
+
+type bpfPanicEvent struct {
+	GoroutineId int64
+	ValueType   uint64
+	Pid         uint32
+	StackId     int32
+	MessageLen  uint32
+	Kind        uint8
+	Message     [128]int8
 	_           [3]byte
 }
 
+type bpfProcessEvent struct {
+	Pid  uint32
+	Ppid uint32
+	Type bpfProcessEventType
+}
+
+type bpfProcessEventType uint32
+
+const (
+	bpfProcessEventTypePROCESS_EXEC bpfProcessEventType = 0
+	bpfProcessEventTypePROCESS_EXIT bpfProcessEventType = 1
+	bpfProcessEventTypePROCESS_FORK bpfProcessEventType = 2
+)
+
+type bpfSchedEvent struct {
+	GoroutineId int64
+	LatencyNs   uint64
+	Pid         uint32
+	_           [4]byte
+}
+
 type bpfStackTraceT [20]uint64
 
+type bpfWaitEvent struct {
+	GoroutineId int64
+	DurationNs  uint64
+	Chan        uint64
+	Pid         uint32
+	StackId     int32
+	Reason      uint8
+	ChanOp      uint8
+	_           [6]byte
+}
+
 // loadBpf returns the embedded CollectionSpec for bpf.
 func loadBpf() (*ebpf.CollectionSpec, error) {
 	reader := bytes.NewReader(_BpfBytes)
@@ -62,16 +132,52 @@ type bpfSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type bpfProgramSpecs struct {
-	RuntimeGoexit1  *ebpf.ProgramSpec `ebpf:"runtime_goexit1"`
-	RuntimeNewproc1 *ebpf.ProgramSpec `ebpf:"runtime_newproc1"`
+	RuntimeCasgstatus         *ebpf.ProgramSpec `ebpf:"runtime_casgstatus"`
+	RuntimeCasgstatusRunnable *ebpf.ProgramSpec `ebpf:"runtime_casgstatus_runnable"`
+	RuntimeChanOpRet          *ebpf.ProgramSpec `ebpf:"runtime_chan_op_ret"`
+	RuntimeChanrecv           *ebpf.ProgramSpec `ebpf:"runtime_chanrecv"`
+	RuntimeChansend           *ebpf.ProgramSpec `ebpf:"runtime_chansend"`
+	RuntimeExecute            *ebpf.ProgramSpec `ebpf:"runtime_execute"`
+	RuntimeFatalpanic         *ebpf.ProgramSpec `ebpf:"runtime_fatalpanic"`
+	RuntimeGoexit1            *ebpf.ProgramSpec `ebpf:"runtime_goexit1"`
+	RuntimeGopanic            *ebpf.ProgramSpec `ebpf:"runtime_gopanic"`
+	RuntimeGopark             *ebpf.ProgramSpec `ebpf:"runtime_gopark"`
+	RuntimeGorecoverRet       *ebpf.ProgramSpec `ebpf:"runtime_gorecover_ret"`
+	RuntimeMakechan           *ebpf.ProgramSpec `ebpf:"runtime_makechan"`
+	RuntimeMakechanRet        *ebpf.ProgramSpec `ebpf:"runtime_makechan_ret"`
+	RuntimeNewproc1           *ebpf.ProgramSpec `ebpf:"runtime_newproc1"`
+	RuntimeNewproc1Entry      *ebpf.ProgramSpec `ebpf:"runtime_newproc1_entry"`
+	RuntimeSelectgo           *ebpf.ProgramSpec `ebpf:"runtime_selectgo"`
+	SchedProcessExec          *ebpf.ProgramSpec `ebpf:"sched_process_exec"`
+	SchedProcessExit          *ebpf.ProgramSpec `ebpf:"sched_process_exit"`
+	SchedProcessFork          *ebpf.ProgramSpec `ebpf:"sched_process_fork"`
+	SyncLockAcquired          *ebpf.ProgramSpec `ebpf:"sync_lock_acquired"`
+	SyncMutexLockSlow         *ebpf.ProgramSpec `ebpf:"sync_mutex_lock_slow"`
+	SyncMutexUnlockSlow       *ebpf.ProgramSpec `ebpf:"sync_mutex_unlock_slow"`
+	SyncRwmutexRunlockSlow    *ebpf.ProgramSpec `ebpf:"sync_rwmutex_runlock_slow"`
+	SyncSemacquireRwmutex     *ebpf.ProgramSpec `ebpf:"sync_semacquire_rwmutex"`
+	SyncSemacquireRwmutexR    *ebpf.ProgramSpec `ebpf:"sync_semacquire_rwmutex_r"`
 }
 
 // bpfMapSpecs contains maps before they are loaded into the kernel.
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type bpfMapSpecs struct {
-	Events         *ebpf.MapSpec `ebpf:"events"`
-	StackAddresses *ebpf.MapSpec `ebpf:"stack_addresses"`
+	ChannelStacks      *ebpf.MapSpec `ebpf:"channel_stacks"`
+	Channels           *ebpf.MapSpec `ebpf:"channels"`
+	Events             *ebpf.MapSpec `ebpf:"events"`
+	LockEvents         *ebpf.MapSpec `ebpf:"lock_events"`
+	PanicEvents        *ebpf.MapSpec `ebpf:"panic_events"`
+	ParentGoroutineIds *ebpf.MapSpec `ebpf:"parent_goroutine_ids"`
+	ParkedGoroutines   *ebpf.MapSpec `ebpf:"parked_goroutines"`
+	PendingChanOps     *ebpf.MapSpec `ebpf:"pending_chan_ops"`
+	PendingChannels    *ebpf.MapSpec `ebpf:"pending_channels"`
+	PendingLocks       *ebpf.MapSpec `ebpf:"pending_locks"`
+	ProcessEvents      *ebpf.MapSpec `ebpf:"process_events"`
+	RunnableGoroutines *ebpf.MapSpec `ebpf:"runnable_goroutines"`
+	SchedEvents        *ebpf.MapSpec `ebpf:"sched_events"`
+	StackAddresses     *ebpf.MapSpec `ebpf:"stack_addresses"`
+	WaitEvents         *ebpf.MapSpec `ebpf:"wait_events"`
 }
 
 // bpfObjects contains all objects after they have been loaded into the kernel.
@@ -93,14 +199,40 @@ func (o *bpfObjects) Close() error {
 //
 // It can be passed to loadBpfObjects or ebpf.CollectionSpec.LoadAndAssign.
 type bpfMaps struct {
-	Events         *ebpf.Map `ebpf:"events"`
-	StackAddresses *ebpf.Map `ebpf:"stack_addresses"`
+	ChannelStacks      *ebpf.Map `ebpf:"channel_stacks"`
+	Channels           *ebpf.Map `ebpf:"channels"`
+	Events             *ebpf.Map `ebpf:"events"`
+	LockEvents         *ebpf.Map `ebpf:"lock_events"`
+	PanicEvents        *ebpf.Map `ebpf:"panic_events"`
+	ParentGoroutineIds *ebpf.Map `ebpf:"parent_goroutine_ids"`
+	ParkedGoroutines   *ebpf.Map `ebpf:"parked_goroutines"`
+	PendingChanOps     *ebpf.Map `ebpf:"pending_chan_ops"`
+	PendingChannels    *ebpf.Map `ebpf:"pending_channels"`
+	PendingLocks       *ebpf.Map `ebpf:"pending_locks"`
+	ProcessEvents      *ebpf.Map `ebpf:"process_events"`
+	RunnableGoroutines *ebpf.Map `ebpf:"runnable_goroutines"`
+	SchedEvents        *ebpf.Map `ebpf:"sched_events"`
+	StackAddresses     *ebpf.Map `ebpf:"stack_addresses"`
+	WaitEvents         *ebpf.Map `ebpf:"wait_events"`
 }
 
 func (m *bpfMaps) Close() error {
 	return _BpfClose(
+		m.ChannelStacks,
+		m.Channels,
 		m.Events,
+		m.LockEvents,
+		m.PanicEvents,
+		m.ParentGoroutineIds,
+		m.ParkedGoroutines,
+		m.PendingChanOps,
+		m.PendingChannels,
+		m.PendingLocks,
+		m.ProcessEvents,
+		m.RunnableGoroutines,
+		m.SchedEvents,
 		m.StackAddresses,
+		m.WaitEvents,
 	)
 }
 
@@ -108,14 +240,60 @@ func (m *bpfMaps) Close() error {
 //
 // It can be passed to loadBpfObjects or ebpf.CollectionSpec.LoadAndAssign.
 type bpfPrograms struct {
-	RuntimeGoexit1  *ebpf.Program `ebpf:"runtime_goexit1"`
-	RuntimeNewproc1 *ebpf.Program `ebpf:"runtime_newproc1"`
+	RuntimeCasgstatus         *ebpf.Program `ebpf:"runtime_casgstatus"`
+	RuntimeCasgstatusRunnable *ebpf.Program `ebpf:"runtime_casgstatus_runnable"`
+	RuntimeChanOpRet          *ebpf.Program `ebpf:"runtime_chan_op_ret"`
+	RuntimeChanrecv           *ebpf.Program `ebpf:"runtime_chanrecv"`
+	RuntimeChansend           *ebpf.Program `ebpf:"runtime_chansend"`
+	RuntimeExecute            *ebpf.Program `ebpf:"runtime_execute"`
+	RuntimeFatalpanic         *ebpf.Program `ebpf:"runtime_fatalpanic"`
+	RuntimeGoexit1            *ebpf.Program `ebpf:"runtime_goexit1"`
+	RuntimeGopanic            *ebpf.Program `ebpf:"runtime_gopanic"`
+	RuntimeGopark             *ebpf.Program `ebpf:"runtime_gopark"`
+	RuntimeGorecoverRet       *ebpf.Program `ebpf:"runtime_gorecover_ret"`
+	RuntimeMakechan           *ebpf.Program `ebpf:"runtime_makechan"`
+	RuntimeMakechanRet        *ebpf.Program `ebpf:"runtime_makechan_ret"`
+	RuntimeNewproc1           *ebpf.Program `ebpf:"runtime_newproc1"`
+	RuntimeNewproc1Entry      *ebpf.Program `ebpf:"runtime_newproc1_entry"`
+	RuntimeSelectgo           *ebpf.Program `ebpf:"runtime_selectgo"`
+	SchedProcessExec          *ebpf.Program `ebpf:"sched_process_exec"`
+	SchedProcessExit          *ebpf.Program `ebpf:"sched_process_exit"`
+	SchedProcessFork          *ebpf.Program `ebpf:"sched_process_fork"`
+	SyncLockAcquired          *ebpf.Program `ebpf:"sync_lock_acquired"`
+	SyncMutexLockSlow         *ebpf.Program `ebpf:"sync_mutex_lock_slow"`
+	SyncMutexUnlockSlow       *ebpf.Program `ebpf:"sync_mutex_unlock_slow"`
+	SyncRwmutexRunlockSlow    *ebpf.Program `ebpf:"sync_rwmutex_runlock_slow"`
+	SyncSemacquireRwmutex     *ebpf.Program `ebpf:"sync_semacquire_rwmutex"`
+	SyncSemacquireRwmutexR    *ebpf.Program `ebpf:"sync_semacquire_rwmutex_r"`
 }
 
 func (p *bpfPrograms) Close() error {
 	return _BpfClose(
+		p.RuntimeCasgstatus,
+		p.RuntimeCasgstatusRunnable,
+		p.RuntimeChanOpRet,
+		p.RuntimeChanrecv,
+		p.RuntimeChansend,
+		p.RuntimeExecute,
+		p.RuntimeFatalpanic,
 		p.RuntimeGoexit1,
+		p.RuntimeGopanic,
+		p.RuntimeGopark,
+		p.RuntimeGorecoverRet,
+		p.RuntimeMakechan,
+		p.RuntimeMakechanRet,
 		p.RuntimeNewproc1,
+		p.RuntimeNewproc1Entry,
+		p.RuntimeSelectgo,
+		p.SchedProcessExec,
+		p.SchedProcessExit,
+		p.SchedProcessFork,
+		p.SyncLockAcquired,
+		p.SyncMutexLockSlow,
+		p.SyncMutexUnlockSlow,
+		p.SyncRwmutexRunlockSlow,
+		p.SyncSemacquireRwmutex,
+		p.SyncSemacquireRwmutexR,
 	)
 }
 
@@ -17,16 +17,42 @@ static __always_inline int read_stack_id(struct pt_regs *ctx, int *stack_id) {
     return 0;
 }
 
+// runtime.newproc1 runs on the system stack, so the current g is g0 when it returns.
+// The creator goroutine is passed as callergp and stored until the uretprobe.
+SEC("uprobe/runtime.newproc1")
+int runtime_newproc1_entry(struct pt_regs *ctx) {
+    // func newproc1(fn *funcval, callergp *g, callerpc uintptr, ...) *g
+    void *callergp = (void *)GO_PARAM2(ctx);
+    if (callergp == NULL) {
+        return 0;
+    }
+    int64_t parent_goid = 0;
+    if (read_goid(callergp, &parent_goid)) {
+        bpf_printk("%s:%d | failed to read goroutine id from callergp\n", __FILE__, __LINE__);
+        return 0;
+    }
+    __u64 pid_tgid = bpf_get_current_pid_tgid();
+    bpf_map_update_elem(&parent_goroutine_ids, &pid_tgid, &parent_goid, BPF_ANY);
+    return 0;
+}
+
 SEC("uretprobe/runtime.newproc1")
 int runtime_newproc1(struct pt_regs *ctx) {
+    __u64 pid_tgid = bpf_get_current_pid_tgid();
+    int64_t parent_goid = 0;
+    int64_t *parent_goid_p = bpf_map_lookup_elem(&parent_goroutine_ids, &pid_tgid);
+    if (parent_goid_p != NULL) {
+        parent_goid = *parent_goid_p;
+        bpf_map_delete_elem(&parent_goroutine_ids, &pid_tgid);
+    }
+
     void *newg_p = (void *)PT_REGS_RC_CORE(ctx);
     if (newg_p == NULL) {
         bpf_printk("%s:%d | failed to extract new goroutine pointer from retval\n", __FILE__, __LINE__);
         return 0;
     }
-    // `pahole -C runtime.g /path/to/gobinary 2>/dev/null` shows the offsets of the goid.
     int64_t goid = 0;
-    if (bpf_core_read_user(&goid, sizeof(int64_t), newg_p + 160)) {
+    if (read_goid(newg_p, &goid)) {
         bpf_printk("%s:%d | failed to read goroutine id from newg with the offset\n", __FILE__, __LINE__);
         return 0;
     }
@@ -34,6 +60,14 @@ int runtime_newproc1(struct pt_regs *ctx) {
         bpf_printk("%s:%d | goroutine id is zero\n", __FILE__, __LINE__);
         return 0;
     }
+    __u64 gopc = 0;
+    if (read_g_field(newg_p, g_gopc_offset, &gopc)) {
+        bpf_printk("%s:%d | failed to read gopc from newg with the offset\n", __FILE__, __LINE__);
+    }
+    __u64 startpc = 0;
+    if (read_g_field(newg_p, g_startpc_offset, &startpc)) {
+        bpf_printk("%s:%d | failed to read startpc from newg with the offset\n", __FILE__, __LINE__);
+    }
     int stack_id = 0;
     if (read_stack_id(ctx, &stack_id)) {
         bpf_printk("%s:%d | failed to read stackid\n", __FILE__, __LINE__);
@@ -47,7 +81,12 @@ int runtime_newproc1(struct pt_regs *ctx) {
         return 0;
     }
     ev->goroutine_id = goid;
+    ev->parent_goroutine_id = parent_goid;
+    ev->gopc = gopc;
+    ev->startpc = startpc;
+    ev->ktime = bpf_ktime_get_ns();
     ev->stack_id = stack_id;
+    ev->pid = pid_tgid >> 32;
     ev->exit = false;
     bpf_ringbuf_submit(ev, 0);
 
@@ -56,9 +95,8 @@ int runtime_newproc1(struct pt_regs *ctx) {
 
 SEC("uprobe/runtime.goexit1")
 int runtime_goexit1(struct pt_regs *ctx) {
-    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
     int64_t go_id = 0;
-    if (read_goroutine_id(task, &go_id)) {
+    if (read_goroutine_id(ctx, &go_id)) {
         bpf_printk("%s:%d | failed to read goroutine id\n", __FILE__, __LINE__);
         return 0;
     }
@@ -75,12 +113,488 @@ int runtime_goexit1(struct pt_regs *ctx) {
         bpf_printk("%s:%d | failed to reserve ringbuf\n", __FILE__, __LINE__);
         return 0;
     }
+    __u64 pid_tgid = bpf_get_current_pid_tgid();
     ev->goroutine_id = go_id;
+    ev->parent_goroutine_id = 0;
+    ev->gopc = 0;
+    ev->startpc = 0;
+    ev->ktime = bpf_ktime_get_ns();
     ev->stack_id = stack_id;
+    ev->pid = pid_tgid >> 32;
     ev->exit = true;
     bpf_ringbuf_submit(ev, 0);
 
     return 0;
 }
 
+// runtime.gopark records the time and the reason that the current goroutine is parked.
+SEC("uprobe/runtime.gopark")
+int runtime_gopark(struct pt_regs *ctx) {
+    // func gopark(unlockf func(*g, unsafe.Pointer) bool, lock unsafe.Pointer, reason waitReason, ...)
+    struct goroutine_key key = {};
+    if (read_goroutine_id(ctx, &key.goroutine_id)) {
+        bpf_printk("%s:%d | failed to read goroutine id\n", __FILE__, __LINE__);
+        return 0;
+    }
+    key.pid = bpf_get_current_pid_tgid() >> 32;
+    struct park park = {
+        .parked_at = bpf_ktime_get_ns(),
+        .reason = (__u8)GO_PARAM3(ctx),
+    };
+    struct chan_op_args *op = bpf_map_lookup_elem(&pending_chan_ops, &key);
+    if (op != NULL) {
+        // runtime.chansend and runtime.chanrecv park with the lock of the channel, and runtime.selectgo parks without a lock.
+        // Otherwise, the goroutine is parked for another reason during the channel operation.
+        __u64 lock = GO_PARAM2(ctx);
+        __u8 on_chan = op->op == CHAN_SELECT ? lock == 0 : lock - op->chan < HCHAN_MAX_SIZE;
+        if (on_chan) {
+            park.chan_op = op->op;
+            park.chan = op->chan;
+            if (read_stack_id(ctx, &park.stack_id)) {
+                park.stack_id = -1;
+            }
+        }
+        bpf_map_delete_elem(&pending_chan_ops, &key);
+    }
+    bpf_map_update_elem(&parked_goroutines, &key, &park, BPF_ANY);
+    return 0;
+}
+
+// record_chan_op records the blocking channel operation of the current goroutine until runtime.gopark or the return.
+static __always_inline int record_chan_op(struct pt_regs *ctx, __u8 op, __u64 chan) {
+    struct goroutine_key key = {};
+    if (read_goroutine_id(ctx, &key.goroutine_id)) {
+        bpf_printk("%s:%d | failed to read goroutine id\n", __FILE__, __LINE__);
+        return 0;
+    }
+    key.pid = bpf_get_current_pid_tgid() >> 32;
+    struct chan_op_args args = {
+        .op = op,
+        .chan = chan,
+    };
+    bpf_map_update_elem(&pending_chan_ops, &key, &args, BPF_ANY);
+    return 0;
+}
+
+SEC("uprobe/runtime.chansend")
+int runtime_chansend(struct pt_regs *ctx) {
+    // func chansend(c *hchan, ep unsafe.Pointer, block bool, callerpc uintptr) bool
+    if (!(__u8)GO_PARAM3(ctx)) {
+        return 0;
+    }
+    return record_chan_op(ctx, CHAN_SEND, GO_PARAM1(ctx));
+}
+
+SEC("uprobe/runtime.chanrecv")
+int runtime_chanrecv(struct pt_regs *ctx) {
+    // func chanrecv(c *hchan, ep unsafe.Pointer, block bool) (selected, received bool)
+    if (!(__u8)GO_PARAM3(ctx)) {
+        return 0;
+    }
+    return record_chan_op(ctx, CHAN_RECV, GO_PARAM1(ctx));
+}
+
+SEC("uprobe/runtime.selectgo")
+int runtime_selectgo(struct pt_regs *ctx) {
+    // func selectgo(cas0 *scase, order0 *uint16, pc0 *uintptr, nsends, nrecvs int, block bool) (int, bool)
+    if (!(__u8)GO_PARAM6(ctx)) {
+        return 0;
+    }
+    return record_chan_op(ctx, CHAN_SELECT, 0);
+}
+
+// runtime_chan_op_ret is attached to the RET instructions of runtime.chansend, runtime.chanrecv and runtime.selectgo.
+// It deletes the channel operation that completed without parking,
+// so that the next park of the goroutine for another reason, such as time.Sleep, is not attributed to the channel.
+SEC("uprobe/runtime.chan_op_ret")
+int runtime_chan_op_ret(struct pt_regs *ctx) {
+    struct goroutine_key key = {};
+    if (read_goroutine_id(ctx, &key.goroutine_id)) {
+        bpf_printk("%s:%d | failed to read goroutine id\n", __FILE__, __LINE__);
+        return 0;
+    }
+    key.pid = bpf_get_current_pid_tgid() >> 32;
+    bpf_map_delete_elem(&pending_chan_ops, &key);
+    return 0;
+}
+
+SEC("uprobe/runtime.makechan")
+int runtime_makechan(struct pt_regs *ctx) {
+    // func makechan(t *chantype, size int) *hchan
+    struct goroutine_key key = {};
+    if (read_goroutine_id(ctx, &key.goroutine_id)) {
+        bpf_printk("%s:%d | failed to read goroutine id\n", __FILE__, __LINE__);
+        return 0;
+    }
+    key.pid = bpf_get_current_pid_tgid() >> 32;
+    struct channel ch = {
+        .chantype = GO_PARAM1(ctx),
+        .stack_id = bpf_get_stackid(ctx, &channel_stacks, BPF_F_USER_STACK),
+    };
+    bpf_map_update_elem(&pending_channels, &key, &ch, BPF_ANY);
+    return 0;
+}
+
+// runtime_makechan_ret is attached to the RET instructions of runtime.makechan.
+SEC("uprobe/runtime.makechan_ret")
+int runtime_makechan_ret(struct pt_regs *ctx) {
+    struct goroutine_key key = {};
+    if (read_goroutine_id(ctx, &key.goroutine_id)) {
+        bpf_printk("%s:%d | failed to read goroutine id\n", __FILE__, __LINE__);
+        return 0;
+    }
+    key.pid = bpf_get_current_pid_tgid() >> 32;
+    struct channel *ch = bpf_map_lookup_elem(&pending_channels, &key);
+    if (ch == NULL) {
+        return 0;
+    }
+    // The return value is in RAX.
+    struct channel_key chan_key = {
+        .pid = key.pid,
+        .chan = GO_PARAM1(ctx),
+    };
+    bpf_map_update_elem(&channels, &chan_key, ch, BPF_ANY);
+    bpf_map_delete_elem(&pending_channels, &key);
+    return 0;
+}
+
+// runtime.casgstatus is probed rather than runtime.goready since every path that makes a parked goroutine runnable
+// changes the status with it, including runtime.goready and the netpoller that does not call runtime.goready.
+SEC("uprobe/runtime.casgstatus")
+int runtime_casgstatus(struct pt_regs *ctx) {
+    // func casgstatus(gp *g, oldval, newval uint32)
+    // Return as early as possible since the function is called on every status change.
+    if ((__u32)GO_PARAM2(ctx) != G_WAITING || (__u32)GO_PARAM3(ctx) != G_RUNNABLE) {
+        return 0;
+    }
+    void *gp = (void *)GO_PARAM1(ctx);
+    if (gp == NULL) {
+        return 0;
+    }
+    struct goroutine_key key = {};
+    if (read_goid(gp, &key.goroutine_id)) {
+        bpf_printk("%s:%d | failed to read goroutine id from gp\n", __FILE__, __LINE__);
+        return 0;
+    }
+    key.pid = bpf_get_current_pid_tgid() >> 32;
+    // The goroutine may have been parked before the attach, or by the runtime without runtime.gopark.
+    struct park *park = bpf_map_lookup_elem(&parked_goroutines, &key);
+    if (park == NULL) {
+        return 0;
+    }
+    struct wait_event *ev;
+    ev = bpf_ringbuf_reserve(&wait_events, sizeof(*ev), 0);
+    if (!ev) {
+        bpf_printk("%s:%d | failed to reserve ringbuf\n", __FILE__, __LINE__);
+        bpf_map_delete_elem(&parked_goroutines, &key);
+        return 0;
+    }
+    ev->goroutine_id = key.goroutine_id;
+    ev->duration_ns = bpf_ktime_get_ns() - park->parked_at;
+    ev->chan = park->chan;
+    ev->pid = key.pid;
+    ev->stack_id = park->stack_id;
+    ev->reason = park->reason;
+    ev->chan_op = park->chan_op;
+    if (park->chan_op == CHAN_SELECT && g_param_offset != 0 && sudog_c_offset != 0) {
+        // The goroutine that completes a case of the select sets gp.param to the sudog of the case.
+        void *sg = NULL;
+        if (!bpf_core_read_user(&sg, sizeof(sg), gp + g_param_offset) && sg != NULL) {
+            bpf_core_read_user(&ev->chan, sizeof(ev->chan), sg + sudog_c_offset);
+        }
+    }
+    bpf_ringbuf_submit(ev, 0);
+    bpf_map_delete_elem(&parked_goroutines, &key);
+    return 0;
+}
+
+static __always_inline int submit_process_event(__u32 pid, __u32 ppid, enum process_event_type type) {
+    struct process_event *ev;
+    ev = bpf_ringbuf_reserve(&process_events, sizeof(*ev), 0);
+    if (!ev) {
+        bpf_printk("%s:%d | failed to reserve ringbuf\n", __FILE__, __LINE__);
+        return 0;
+    }
+    ev->pid = pid;
+    ev->ppid = ppid;
+    ev->type = type;
+    bpf_ringbuf_submit(ev, 0);
+    return 0;
+}
+
+// submit_current_process_event submits the process event of the current task.
+static __always_inline int submit_current_process_event(enum process_event_type type) {
+    __u64 pid_tgid = bpf_get_current_pid_tgid();
+    // Threads other than the thread group leader are not processes.
+    if ((__u32)pid_tgid != pid_tgid >> 32) {
+        return 0;
+    }
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    return submit_process_event(pid_tgid >> 32, BPF_CORE_READ(task, real_parent, tgid), type);
+}
+
+SEC("tracepoint/sched/sched_process_exec")
+int sched_process_exec(void *ctx) {
+    return submit_current_process_event(PROCESS_EXEC);
+}
+
+SEC("tracepoint/sched/sched_process_exit")
+int sched_process_exit(void *ctx) {
+    return submit_current_process_event(PROCESS_EXIT);
+}
+
+// The raw tracepoint is used since the tracepoint does not tell a new process from a new thread.
+// The arguments are the parent and the child task.
+SEC("raw_tracepoint/sched_process_fork")
+int sched_process_fork(struct bpf_raw_tracepoint_args *ctx) {
+    struct task_struct *parent = (struct task_struct *)ctx->args[0];
+    struct task_struct *child = (struct task_struct *)ctx->args[1];
+    __u32 pid = BPF_CORE_READ(child, pid);
+    __u32 tgid = BPF_CORE_READ(child, tgid);
+    if (pid != tgid) {
+        return 0;
+    }
+    return submit_process_event(tgid, BPF_CORE_READ(parent, tgid), PROCESS_FORK);
+}
+
+// start_lock_wait records the lock that the current goroutine starts waiting for until the slow path returns.
+static __always_inline int start_lock_wait(struct pt_regs *ctx, __u8 op) {
+    struct goroutine_key key = {};
+    if (read_goroutine_id(ctx, &key.goroutine_id)) {
+        bpf_printk("%s:%d | failed to read goroutine id\n", __FILE__, __LINE__);
+        return 0;
+    }
+    key.pid = bpf_get_current_pid_tgid() >> 32;
+    struct lock_wait wait = {
+        .lock = GO_PARAM1(ctx),
+        .started_at = bpf_ktime_get_ns(),
+        .op = op,
+    };
+    if (read_stack_id(ctx, &wait.stack_id)) {
+        wait.stack_id = -1;
+    }
+    bpf_map_update_elem(&pending_locks, &key, &wait, BPF_ANY);
+    return 0;
+}
+
+SEC("uprobe/sync.Mutex.lockSlow")
+int sync_mutex_lock_slow(struct pt_regs *ctx) {
+    // func (m *Mutex) lockSlow()
+    return start_lock_wait(ctx, LOCK_MUTEX);
+}
+
+SEC("uprobe/sync.runtime_SemacquireRWMutexR")
+int sync_semacquire_rwmutex_r(struct pt_regs *ctx) {
+    // func runtime_SemacquireRWMutexR(s *uint32, lifo bool, skipframes int)
+    return start_lock_wait(ctx, LOCK_RLOCK);
+}
+
+SEC("uprobe/sync.runtime_SemacquireRWMutex")
+int sync_semacquire_rwmutex(struct pt_regs *ctx) {
+    // func runtime_SemacquireRWMutex(s *uint32, lifo bool, skipframes int)
+    return start_lock_wait(ctx, LOCK_WLOCK);
+}
+
+// sync_lock_acquired is attached to the RET instructions of the slow paths.
+SEC("uprobe/sync.lock_acquired")
+int sync_lock_acquired(struct pt_regs *ctx) {
+    struct goroutine_key key = {};
+    if (read_goroutine_id(ctx, &key.goroutine_id)) {
+        bpf_printk("%s:%d | failed to read goroutine id\n", __FILE__, __LINE__);
+        return 0;
+    }
+    key.pid = bpf_get_current_pid_tgid() >> 32;
+    struct lock_wait *wait = bpf_map_lookup_elem(&pending_locks, &key);
+    if (wait == NULL) {
+        return 0;
+    }
+    struct lock_event *ev;
+    ev = bpf_ringbuf_reserve(&lock_events, sizeof(*ev), 0);
+    if (!ev) {
+        bpf_printk("%s:%d | failed to reserve ringbuf\n", __FILE__, __LINE__);
+        bpf_map_delete_elem(&pending_locks, &key);
+        return 0;
+    }
+    ev->goroutine_id = key.goroutine_id;
+    ev->duration_ns = bpf_ktime_get_ns() - wait->started_at;
+    ev->lock = wait->lock;
+    ev->pid = key.pid;
+    ev->stack_id = wait->stack_id;
+    ev->op = wait->op;
+    bpf_ringbuf_submit(ev, 0);
+    bpf_map_delete_elem(&pending_locks, &key);
+    return 0;
+}
+
+// submit_unlock_event notifies gmon of the unlock that wakes up waiters.
+static __always_inline int submit_unlock_event(struct pt_regs *ctx, __u8 op) {
+    struct lock_event *ev;
+    ev = bpf_ringbuf_reserve(&lock_events, sizeof(*ev), 0);
+    if (!ev) {
+        bpf_printk("%s:%d | failed to reserve ringbuf\n", __FILE__, __LINE__);
+        return 0;
+    }
+    if (read_goroutine_id(ctx, &ev->goroutine_id)) {
+        bpf_printk("%s:%d | failed to read goroutine id\n", __FILE__, __LINE__);
+        bpf_ringbuf_discard(ev, 0);
+        return 0;
+    }
+    ev->duration_ns = 0;
+    ev->lock = GO_PARAM1(ctx);
+    ev->pid = bpf_get_current_pid_tgid() >> 32;
+    if (read_stack_id(ctx, &ev->stack_id)) {
+        ev->stack_id = -1;
+    }
+    ev->op = op;
+    bpf_ringbuf_submit(ev, 0);
+    return 0;
+}
+
+SEC("uprobe/sync.Mutex.unlockSlow")
+int sync_mutex_unlock_slow(struct pt_regs *ctx) {
+    // func (m *Mutex) unlockSlow(new int32)
+    return submit_unlock_event(ctx, UNLOCK_MUTEX);
+}
+
+SEC("uprobe/sync.RWMutex.rUnlockSlow")
+int sync_rwmutex_runlock_slow(struct pt_regs *ctx) {
+    // func (rw *RWMutex) rUnlockSlow(r int32)
+    return submit_unlock_event(ctx, UNLOCK_RUNLOCK);
+}
+
+// reserve_panic_event reserves the event of the panic of the current goroutine, or returns NULL on failure.
+// The caller fills the fields specific to the kind and submits it.
+static __always_inline struct panic_event *reserve_panic_event(struct pt_regs *ctx, __u8 kind) {
+    struct panic_event *ev;
+    ev = bpf_ringbuf_reserve(&panic_events, sizeof(*ev), 0);
+    if (!ev) {
+        bpf_printk("%s:%d | failed to reserve ringbuf\n", __FILE__, __LINE__);
+        return NULL;
+    }
+    if (read_goroutine_id(ctx, &ev->goroutine_id)) {
+        bpf_printk("%s:%d | failed to read goroutine id\n", __FILE__, __LINE__);
+        bpf_ringbuf_discard(ev, 0);
+        return NULL;
+    }
+    ev->value_type = 0;
+    ev->pid = bpf_get_current_pid_tgid() >> 32;
+    if (read_stack_id(ctx, &ev->stack_id)) {
+        ev->stack_id = -1;
+    }
+    ev->message_len = 0;
+    ev->kind = kind;
+    return ev;
+}
+
+SEC("uprobe/runtime.gopanic")
+int runtime_gopanic(struct pt_regs *ctx) {
+    // func gopanic(e any)
+    struct panic_event *ev = reserve_panic_event(ctx, PANIC_START);
+    if (ev == NULL) {
+        return 0;
+    }
+    // The interface is passed as the type in RAX and the data in RBX.
+    ev->value_type = GO_PARAM1(ctx);
+    // The data may point to a string header. gmon uses the message only if the type is string.
+    void *data = (void *)GO_PARAM2(ctx);
+    struct {
+        void *ptr;
+        __u64 len;
+    } str = {};
+    if (data != NULL && !bpf_probe_read_user(&str, sizeof(str), data) && str.ptr != NULL) {
+        __u32 len = str.len < PANIC_MESSAGE_SIZE - 1 ? str.len : PANIC_MESSAGE_SIZE - 1;
+        // Bound the size for the verifier.
+        len &= PANIC_MESSAGE_SIZE - 1;
+        if (len > 0 && !bpf_probe_read_user(ev->message, len, str.ptr)) {
+            ev->message_len = len;
+        }
+    }
+    bpf_ringbuf_submit(ev, 0);
+    return 0;
+}
+
+// runtime_gorecover_ret is attached to the RET instructions of runtime.gorecover.
+SEC("uprobe/runtime.gorecover_ret")
+int runtime_gorecover_ret(struct pt_regs *ctx) {
+    // func gorecover() any returns nil unless it recovers from a panic.
+    if (GO_PARAM1(ctx) == 0) {
+        return 0;
+    }
+    struct panic_event *ev = reserve_panic_event(ctx, PANIC_RECOVERED);
+    if (ev == NULL) {
+        return 0;
+    }
+    bpf_ringbuf_submit(ev, 0);
+    return 0;
+}
+
+SEC("uprobe/runtime.fatalpanic")
+int runtime_fatalpanic(struct pt_regs *ctx) {
+    // func fatalpanic(msgs *_panic)
+    struct panic_event *ev = reserve_panic_event(ctx, PANIC_FATAL);
+    if (ev == NULL) {
+        return 0;
+    }
+    bpf_ringbuf_submit(ev, 0);
+    return 0;
+}
+
+// runtime.casgstatus is probed rather than runtime.ready and runtime.runqput since every path that makes a goroutine runnable
+// changes the status with it, including the creation, runtime.Gosched, the preemption and the netpoller.
+SEC("uprobe/runtime.casgstatus_runnable")
+int runtime_casgstatus_runnable(struct pt_regs *ctx) {
+    // func casgstatus(gp *g, oldval, newval uint32)
+    // Return as early as possible since the function is called on every status change.
+    if ((__u32)GO_PARAM3(ctx) != G_RUNNABLE) {
+        return 0;
+    }
+    void *gp = (void *)GO_PARAM1(ctx);
+    if (gp == NULL) {
+        return 0;
+    }
+    struct goroutine_key key = {};
+    if (read_goid(gp, &key.goroutine_id)) {
+        bpf_printk("%s:%d | failed to read goroutine id from gp\n", __FILE__, __LINE__);
+        return 0;
+    }
+    key.pid = bpf_get_current_pid_tgid() >> 32;
+    __u64 now = bpf_ktime_get_ns();
+    bpf_map_update_elem(&runnable_goroutines, &key, &now, BPF_ANY);
+    return 0;
+}
+
+// runtime.execute runs the runnable goroutine on the current M with a P.
+SEC("uprobe/runtime.execute")
+int runtime_execute(struct pt_regs *ctx) {
+    // func execute(gp *g, inheritTime bool)
+    void *gp = (void *)GO_PARAM1(ctx);
+    if (gp == NULL) {
+        return 0;
+    }
+    struct goroutine_key key = {};
+    if (read_goid(gp, &key.goroutine_id)) {
+        bpf_printk("%s:%d | failed to read goroutine id from gp\n", __FILE__, __LINE__);
+        return 0;
+    }
+    key.pid = bpf_get_current_pid_tgid() >> 32;
+    // The goroutine may have become runnable before the attach.
+    __u64 *runnable_at = bpf_map_lookup_elem(&runnable_goroutines, &key);
+    if (runnable_at == NULL) {
+        return 0;
+    }
+    struct sched_event *ev;
+    ev = bpf_ringbuf_reserve(&sched_events, sizeof(*ev), 0);
+    if (!ev) {
+        bpf_printk("%s:%d | failed to reserve ringbuf\n", __FILE__, __LINE__);
+        bpf_map_delete_elem(&runnable_goroutines, &key);
+        return 0;
+    }
+    ev->goroutine_id = key.goroutine_id;
+    ev->latency_ns = bpf_ktime_get_ns() - *runnable_at;
+    ev->pid = key.pid;
+    bpf_ringbuf_submit(ev, 0);
+    bpf_map_delete_elem(&runnable_goroutines, &key);
+    return 0;
+}
+
 char LICENSE[] SEC("license") = "GPL";
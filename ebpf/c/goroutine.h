@@ -3,60 +3,77 @@
 #include <bpf/bpf_core_read.h>
 #include <bpf/bpf_helpers.h>
 
-struct stack_t {
-    uintptr_t lo;
-    uintptr_t hi;
-};
+// Go's internal register-based calling convention on amd64 passes integer arguments in
+// RAX, RBX, RCX, RDI, RSI, R8, R9, R10 and R11 in order.
+// https://github.com/golang/go/blob/release-branch.go1.23/src/cmd/compile/abi-internal.md#amd64-architecture
+#define GO_PARAM1(x) BPF_CORE_READ((x), ax)
+#define GO_PARAM2(x) BPF_CORE_READ((x), bx)
+#define GO_PARAM3(x) BPF_CORE_READ((x), cx)
+#define GO_PARAM4(x) BPF_CORE_READ((x), di)
+#define GO_PARAM5(x) BPF_CORE_READ((x), si)
+#define GO_PARAM6(x) BPF_CORE_READ((x), r8)
+// R14 holds the current g in Go functions with the internal ABI.
+#define GO_G(x) BPF_CORE_READ((x), r14)
+// The results of a Go function are in the GO_PARAM registers at its RET instructions.
+// Programs that run when a Go function returns are attached as uprobes to its RET instructions instead of uretprobes,
+// which replace the return address on the stack and break the stack unwinding of the Go runtime.
 
-struct gobuf_t {
-    uintptr_t sp;
-    uintptr_t pc;
-    uintptr_t g;
-    uintptr_t ctxt;
-    uintptr_t ret;
-    uintptr_t lr;
-    uintptr_t bp;
-};
+// Values of runtime.g.atomicstatus.
+// https://github.com/golang/go/blob/release-branch.go1.23/src/runtime/runtime2.go#L36
+#define G_RUNNABLE 1
+#define G_WAITING 4
 
+// runtime.hchan is smaller than this, so a lock within this range from the channel is the lock of the channel.
+// https://github.com/golang/go/blob/release-branch.go1.23/src/runtime/chan.go#L34
+#define HCHAN_MAX_SIZE 256
+
+// Offsets of runtime.g fields. gmon rewrites them at load time with the offsets
+// resolved from the DWARF or the Go version of the target executable.
 // https://github.com/golang/go/blob/release-branch.go1.23/src/runtime/runtime2.go#L458
-struct g_t {
-    struct stack_t stack_instance;
-    uintptr_t stackguard0;
-    uintptr_t stackguard1;
-    uintptr_t _panic;
-    uintptr_t _defer;
-    uintptr_t m;
-    struct gobuf_t sched;
-    uintptr_t syscallsp;
-    uintptr_t syscallpc;
-    uintptr_t syscallbp;
-    uintptr_t stktopsp;
-    uintptr_t param;
-    uint32_t atomicstatus;
-    uint32_t stackLock;
-    int64_t goid;
-};
+volatile const __u64 g_goid_offset = 160;
+// 0 if the offset is unknown.
+volatile const __u64 g_gopc_offset = 0;
+volatile const __u64 g_startpc_offset = 0;
+volatile const __u64 g_param_offset = 0;
+// Offset of runtime.sudog.c. 0 if the offset is unknown.
+volatile const __u64 sudog_c_offset = 0;
 
-// read_goroutine_id reads the goroutine id from the task_struct.
+// read_goid reads the goroutine id from the runtime.g at g_addr.
 // 1 on failure.
-static __always_inline int read_goroutine_id(struct task_struct *task, int64_t *goroutine_id) {
-    void *base;
-    BPF_CORE_READ_INTO(&base, &(task->thread), fsbase);
-    if (base == NULL) {
+static __always_inline int read_goid(void *g_addr, int64_t *goroutine_id) {
+    if (bpf_core_read_user(goroutine_id, sizeof(int64_t), g_addr + g_goid_offset)) {
         return 1;
     }
+    return 0;
+}
 
-    // https://www.usenix.org/conference/srecon23apac/presentation/liang
-    uintptr_t g_addr = 0;
-    if (bpf_core_read_user(&g_addr, sizeof(uintptr_t), base - 8)) {
+// read_g_field reads a pointer-sized field of the runtime.g at g_addr.
+// It leaves the value as 0 if the offset is unknown.
+// 1 on failure.
+static __always_inline int read_g_field(void *g_addr, __u64 offset, __u64 *value) {
+    if (offset == 0) {
+        *value = 0;
+        return 0;
+    }
+    if (bpf_core_read_user(value, sizeof(__u64), g_addr + offset)) {
+        return 1;
+    }
+    return 0;
+}
+
+// read_goroutine_id reads the goroutine id of the current g at the entry of a Go function.
+// The g is read from R14 rather than the TLS slot at fsbase - 8 since the slot is at a different offset
+// if the Go runtime lives in a shared object built with -buildmode=c-shared.
+// 1 on failure.
+static __always_inline int read_goroutine_id(struct pt_regs *ctx, int64_t *goroutine_id) {
+    void *g_addr = (void *)GO_G(ctx);
+    if (g_addr == NULL) {
         return 1;
     }
 
-    struct g_t g;
-    if (bpf_core_read_user(&g, sizeof(struct g_t), (void *)g_addr)) {
+    if (read_goid(g_addr, goroutine_id)) {
         return 1;
     }
-    *goroutine_id = g.goid;
 
     // TODO: Why is this happening? We may be able to ignore this.
     // The Go runtime manages goroutines, and developers generally don't need to interact with
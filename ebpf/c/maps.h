@@ -5,7 +5,8 @@
 
 #include <bpf/bpf_helpers.h>
 
-#define MAX_STACK_ADDRESSES 1024 // max amount of diff stack trace addrs to buffer
+#define MAX_STACK_ADDRESSES 16384 // max amount of diff stack trace addrs to buffer
+#define MAX_CHANNEL_STACKS 4096   // max amount of diff creation stacks of channels
 #define MAX_STACK_DEPTH 20 // max depth of each stack trace to track
 
 #define BPF_MAP(_name, _type, _key_type, _value_type, _max_entries) \
@@ -22,6 +23,12 @@ typedef __u64 stack_trace_t[MAX_STACK_DEPTH];
     BPF_MAP(_name, BPF_MAP_TYPE_STACK_TRACE, u32, stack_trace_t, _max_entries)
 
 BPF_STACK_TRACE(stack_addresses, MAX_STACK_ADDRESSES); // store stack traces
+// creation stacks of channels, apart from stack_addresses since runtime.makechan records the stack of every channel,
+// and most of them are never looked up. Creation stacks are unknown when it is full, without affecting the other probes.
+BPF_STACK_TRACE(channel_stacks, MAX_CHANNEL_STACKS);
+
+// goroutine id of the caller of runtime.newproc1 keyed by pid_tgid until runtime.newproc1 returns
+BPF_MAP(parent_goroutine_ids, BPF_MAP_TYPE_HASH, u64, int64_t, 10240);
 
 struct {
     __uint(type, BPF_MAP_TYPE_RINGBUF);
@@ -30,10 +37,181 @@ struct {
 
 struct event {
     int64_t goroutine_id;
+    int64_t parent_goroutine_id;
+    __u64 gopc;
+    __u64 startpc;
+    __u64 ktime; // nanoseconds since boot by bpf_ktime_get_ns, CLOCK_MONOTONIC
     int stack_id;
+    __u32 pid;
     bool exit;
 };
 
 struct event *unused __attribute__((unused));
 
+// goroutine_key identifies a goroutine across processes.
+struct goroutine_key {
+    __u32 pid;
+    int64_t goroutine_id;
+};
+
+enum chan_op {
+    CHAN_NONE,
+    CHAN_SEND,
+    CHAN_RECV,
+    CHAN_SELECT,
+};
+
+struct park {
+    __u64 parked_at; // nanoseconds since boot
+    __u8 reason;     // runtime.waitReason
+    // The fields below are set if the goroutine is parked on a channel.
+    __u8 chan_op;    // enum chan_op
+    int stack_id;    // the stack of the waiter
+    __u64 chan;      // *hchan, 0 for select until the goroutine is woken up
+};
+
+struct chan_op_args {
+    __u8 op; // enum chan_op
+    __u64 chan;
+};
+
+// blocking channel operations keyed by pid and goroutine id from the entry until runtime.gopark or the return
+BPF_MAP(pending_chan_ops, BPF_MAP_TYPE_LRU_HASH, struct goroutine_key, struct chan_op_args, 10240);
+
+struct channel_key {
+    __u32 pid;
+    __u64 chan;
+};
+
+struct channel {
+    __u64 chantype; // *chantype passed to runtime.makechan
+    int stack_id;   // the stack of the creator in channel_stacks
+};
+
+// channels created by runtime.makechan keyed by pid and goroutine id from the entry until the return
+BPF_MAP(pending_channels, BPF_MAP_TYPE_LRU_HASH, struct goroutine_key, struct channel, 10240);
+// channels keyed by pid and *hchan
+BPF_MAP(channels, BPF_MAP_TYPE_LRU_HASH, struct channel_key, struct channel, 65536);
+
+// parked goroutines keyed by pid and goroutine id from runtime.gopark until they become runnable
+BPF_MAP(parked_goroutines, BPF_MAP_TYPE_LRU_HASH, struct goroutine_key, struct park, 65536);
+
+// wait_events notifies gmon of goroutines that become runnable after being parked.
+struct {
+    __uint(type, BPF_MAP_TYPE_RINGBUF);
+    __uint(max_entries, 1 << 22);
+} wait_events SEC(".maps");
+
+struct wait_event {
+    int64_t goroutine_id;
+    __u64 duration_ns;
+    __u64 chan;
+    __u32 pid;
+    int stack_id;
+    __u8 reason;
+    __u8 chan_op;
+};
+
+struct wait_event *unused_wait_event __attribute__((unused));
+
+enum lock_op {
+    LOCK_NONE,
+    LOCK_MUTEX,     // sync.Mutex.Lock and sync.RWMutex.Lock waiting for the writer lock
+    LOCK_RLOCK,     // sync.RWMutex.RLock waiting for the writer
+    LOCK_WLOCK,     // sync.RWMutex.Lock waiting for the readers
+    UNLOCK_MUTEX,   // sync.Mutex.Unlock waking up a waiter
+    UNLOCK_RUNLOCK, // sync.RWMutex.RUnlock waking up the writer
+};
+
+struct lock_wait {
+    __u64 lock;       // the address of the semaphore or the mutex
+    __u64 started_at; // nanoseconds since boot
+    int stack_id;     // the stack of the waiter
+    __u8 op;          // enum lock_op
+};
+
+// goroutines waiting for locks keyed by pid and goroutine id from the entry until the return of the slow path
+BPF_MAP(pending_locks, BPF_MAP_TYPE_LRU_HASH, struct goroutine_key, struct lock_wait, 10240);
+
+// lock_events notifies gmon of goroutines that acquired or released contended locks.
+struct {
+    __uint(type, BPF_MAP_TYPE_RINGBUF);
+    __uint(max_entries, 1 << 22);
+} lock_events SEC(".maps");
+
+struct lock_event {
+    int64_t goroutine_id;
+    __u64 duration_ns; // 0 for unlocks
+    __u64 lock;        // the address of the semaphore or the mutex
+    __u32 pid;
+    int stack_id;
+    __u8 op; // enum lock_op
+};
+
+struct lock_event *unused_lock_event __attribute__((unused));
+
+// panic_events notifies gmon of goroutines that panic, recover and crash the process.
+struct {
+    __uint(type, BPF_MAP_TYPE_RINGBUF);
+    __uint(max_entries, 1 << 20);
+} panic_events SEC(".maps");
+
+#define PANIC_MESSAGE_SIZE 128
+
+enum panic_kind {
+    PANIC_NONE,
+    PANIC_START,     // runtime.gopanic
+    PANIC_RECOVERED, // runtime.gorecover returned the panic value
+    PANIC_FATAL,     // runtime.fatalpanic
+};
+
+struct panic_event {
+    int64_t goroutine_id;
+    __u64 value_type; // the *_type of the panic value, 0 unless the kind is PANIC_START
+    __u32 pid;
+    int stack_id;
+    __u32 message_len; // the length of message if the panic value is a string
+    __u8 kind;         // enum panic_kind
+    char message[PANIC_MESSAGE_SIZE];
+};
+
+struct panic_event *unused_panic_event __attribute__((unused));
+
+// nanoseconds since boot keyed by pid and goroutine id from the transition to _Grunnable until runtime.execute
+BPF_MAP(runnable_goroutines, BPF_MAP_TYPE_LRU_HASH, struct goroutine_key, __u64, 65536);
+
+// sched_events notifies gmon of goroutines that get a P after being runnable.
+struct {
+    __uint(type, BPF_MAP_TYPE_RINGBUF);
+    __uint(max_entries, 1 << 22);
+} sched_events SEC(".maps");
+
+struct sched_event {
+    int64_t goroutine_id;
+    __u64 latency_ns;
+    __u32 pid;
+};
+
+struct sched_event *unused_sched_event __attribute__((unused));
+
+// process_events notifies gmon of processes that fork, exec or exit to attach and detach uprobes.
+struct {
+    __uint(type, BPF_MAP_TYPE_RINGBUF);
+    __uint(max_entries, 1 << 16);
+} process_events SEC(".maps");
+
+enum process_event_type {
+    PROCESS_EXEC,
+    PROCESS_EXIT,
+    PROCESS_FORK,
+};
+
+struct process_event {
+    __u32 pid;
+    __u32 ppid;
+    enum process_event_type type;
+};
+
+struct process_event *unused_process_event __attribute__((unused));
+
 #endif /* __MAPS_H__ */
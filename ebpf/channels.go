@@ -0,0 +1,171 @@
+package ebpf
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// maxChannels bounds the number of channels whose blocked time is analyzed. The least recently blocked ones are dropped.
+const maxChannels = 4096
+
+// channelOps are the names of enum chan_op.
+var channelOps = []string{"", "send", "receive", "select"}
+
+func channelOpName(op uint8) string {
+	if int(op) < len(channelOps) {
+		return channelOps[op]
+	}
+	return strconv.Itoa(int(op))
+}
+
+// channelKey identifies a channel across processes since addresses are only unique within a process.
+type channelKey struct {
+	pid  uint32
+	addr uint64
+}
+
+// channelStat is the time that goroutines were blocked on a channel.
+type channelStat struct {
+	Pid            uint32          `json:"pid"`
+	Address        string          `json:"address"`
+	Type           string          `json:"type,omitempty"`       // empty if the channel was created before the attach
+	CreatedBy      []*locationView `json:"created_by,omitempty"` // the stack of runtime.makechan
+	BlockedSeconds float64         `json:"blocked_seconds"`
+	Waits          int             `json:"waits"`
+	Waiters        []*waiterSite   `json:"waiters"`
+	blocked        time.Duration
+	waiters        waiterSites
+}
+
+// channelAnalyzer aggregates the time that goroutines were blocked on channels by channel and waiter site.
+// The creator of a channel is recorded by runtime.makechan, so it is unknown for channels created before the attach.
+type channelAnalyzer struct {
+	objs         *bpfObjects
+	eventHandler *eventHandler
+	attacher     *attacher
+
+	mu       sync.Mutex
+	channels *lru.Cache[channelKey, *channelStat]
+}
+
+func newChannelAnalyzer(objs *bpfObjects, eventHandler *eventHandler, attacher *attacher) *channelAnalyzer {
+	channels, err := lru.New[channelKey, *channelStat](maxChannels)
+	if err != nil {
+		// The size is a positive constant.
+		panic(err)
+	}
+	return &channelAnalyzer{
+		objs:         objs,
+		eventHandler: eventHandler,
+		attacher:     attacher,
+		channels:     channels,
+	}
+}
+
+// observe records the wait event of a goroutine blocked on a channel.
+func (a *channelAnalyzer) observe(ctx context.Context, event bpfWaitEvent) {
+	if event.Chan == 0 {
+		// The channel of the select is unknown.
+		return
+	}
+	key := channelKey{pid: event.Pid, addr: event.Chan}
+	var typ string
+	var creator []location
+	if _, ok := a.channels.Peek(key); !ok {
+		typ, creator = a.creator(ctx, key)
+	}
+	var waiter []location
+	if event.StackId >= 0 {
+		var err error
+		waiter, err = a.eventHandler.stack(ctx, event.Pid, event.StackId)
+		if err != nil {
+			slog.Debug("failed to look up the stack of the channel waiter", slog.Any("error", err))
+		}
+	}
+	a.record(key, channelOpName(event.ChanOp), waiter, time.Duration(event.DurationNs), typ, creator)
+}
+
+// creator returns the element type and the creation stack of the channel recorded by runtime.makechan.
+// The creation stacks are in channel_stacks, which is never deleted since channels of the same stack share the stack id.
+func (a *channelAnalyzer) creator(ctx context.Context, key channelKey) (string, []location) {
+	var ch bpfChannel
+	if err := a.objs.Channels.Lookup(bpfChannelKey{Pid: key.pid, Chan: key.addr}, &ch); err != nil {
+		return "", nil
+	}
+	var creator []location
+	if ch.StackId >= 0 {
+		stack, err := a.eventHandler.lookupStackIn(ctx, a.objs.ChannelStacks, key.pid, ch.StackId)
+		if err != nil {
+			slog.Debug("failed to look up the stack of the channel creator", slog.Any("error", err))
+		}
+		creator = stack
+	}
+	return a.typeName(key.pid, ch.Chantype), creator
+}
+
+// typeName returns the name of the channel type, or the address of the type descriptor if the name is unknown.
+func (a *channelAnalyzer) typeName(pid uint32, chantype uint64) string {
+	fallback := fmt.Sprintf("%#x", chantype)
+	object, path, ok := a.attacher.goObject(int(pid))
+	if !ok {
+		return fallback
+	}
+	if name, ok := object.typeName(int(pid), path, chantype); ok {
+		return name
+	}
+	return fallback
+}
+
+// record adds the blocked time of the waiter to the channel.
+// typ and creator are only used when the channel is recorded for the first time.
+func (a *channelAnalyzer) record(key channelKey, op string, waiter []location, blocked time.Duration, typ string, creator []location) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stat, ok := a.channels.Get(key)
+	if !ok {
+		stat = &channelStat{
+			Pid:       key.pid,
+			Address:   fmt.Sprintf("%#x", key.addr),
+			Type:      typ,
+			CreatedBy: newStackView(creator),
+			waiters:   make(waiterSites),
+		}
+		a.channels.Add(key, stat)
+	}
+	stat.blocked += blocked
+	stat.Waits++
+	stat.waiters.add(op, waiter, blocked)
+}
+
+// topChannels returns the channels that goroutines were blocked on the longest, up to limit.
+func (a *channelAnalyzer) topChannels(limit int) []channelStat {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stats := make([]channelStat, 0, a.channels.Len())
+	for _, s := range a.channels.Values() {
+		stat := *s
+		stat.BlockedSeconds = s.blocked.Seconds()
+		stat.Waiters = s.waiters.sorted()
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].blocked != stats[j].blocked {
+			return stats[i].blocked > stats[j].blocked
+		}
+		if stats[i].Pid != stats[j].Pid {
+			return stats[i].Pid < stats[j].Pid
+		}
+		return stats[i].Address < stats[j].Address
+	})
+	if len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats
+}
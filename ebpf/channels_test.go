@@ -0,0 +1,124 @@
+package ebpf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_channelAnalyzer_topChannels(t *testing.T) {
+	sender := []location{{PC: 0x10, Function: "main.send"}, {PC: 0x20, Function: "main.main"}}
+	receiver := []location{{PC: 0x30, Function: "main.receive"}}
+	creator := []location{{PC: 0x40, Function: "main.newQueue"}}
+
+	a := newChannelAnalyzer(nil, nil, nil)
+	a.record(channelKey{pid: 100, addr: 0xc000010000}, "send", sender, 2*time.Second, "chan int", creator)
+	a.record(channelKey{pid: 100, addr: 0xc000010000}, "send", sender, time.Second, "", nil)
+	a.record(channelKey{pid: 100, addr: 0xc000010000}, "receive", receiver, 4*time.Second, "", nil)
+	// The channel was created before the attach.
+	a.record(channelKey{pid: 100, addr: 0xc000020000}, "select", receiver, 5*time.Second, "", nil)
+	a.record(channelKey{pid: 200, addr: 0xc000010000}, "receive", receiver, time.Millisecond, "chan struct {}", nil)
+
+	tests := []struct {
+		name  string
+		limit int
+		want  []channelStat
+	}{
+		{
+			name:  "all",
+			limit: 10,
+			want: []channelStat{
+				{
+					Pid:            100,
+					Address:        "0xc000010000",
+					Type:           "chan int",
+					CreatedBy:      newStackView(creator),
+					BlockedSeconds: 7,
+					Waits:          3,
+					Waiters: []*waiterSite{
+						{Op: "receive", Stack: newStackView(receiver), BlockedSeconds: 4, Waits: 1},
+						{Op: "send", Stack: newStackView(sender), BlockedSeconds: 3, Waits: 2},
+					},
+				},
+				{
+					Pid:            100,
+					Address:        "0xc000020000",
+					BlockedSeconds: 5,
+					Waits:          1,
+					Waiters: []*waiterSite{
+						{Op: "select", Stack: newStackView(receiver), BlockedSeconds: 5, Waits: 1},
+					},
+				},
+				{
+					Pid:            200,
+					Address:        "0xc000010000",
+					Type:           "chan struct {}",
+					CreatedBy:      []*locationView{},
+					BlockedSeconds: 0.001,
+					Waits:          1,
+					Waiters: []*waiterSite{
+						{Op: "receive", Stack: newStackView(receiver), BlockedSeconds: 0.001, Waits: 1},
+					},
+				},
+			},
+		},
+		{
+			name:  "limited",
+			limit: 1,
+			want:  []channelStat{{Pid: 100, Address: "0xc000010000"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := a.topChannels(tt.limit)
+			require.Len(t, got, len(tt.want))
+			for i := range tt.want {
+				assert.Equal(t, tt.want[i].Pid, got[i].Pid)
+				assert.Equal(t, tt.want[i].Address, got[i].Address)
+				if tt.want[i].Waiters == nil {
+					continue
+				}
+				assert.Equal(t, tt.want[i].Type, got[i].Type)
+				assert.Len(t, got[i].CreatedBy, len(tt.want[i].CreatedBy))
+				assert.InDelta(t, tt.want[i].BlockedSeconds, got[i].BlockedSeconds, 1e-9)
+				assert.Equal(t, tt.want[i].Waits, got[i].Waits)
+				require.Len(t, got[i].Waiters, len(tt.want[i].Waiters))
+				for j, w := range tt.want[i].Waiters {
+					assert.Equal(t, w.Op, got[i].Waiters[j].Op)
+					assert.Equal(t, w.Stack, got[i].Waiters[j].Stack)
+					assert.InDelta(t, w.BlockedSeconds, got[i].Waiters[j].BlockedSeconds, 1e-9)
+					assert.Equal(t, w.Waits, got[i].Waiters[j].Waits)
+				}
+			}
+		})
+	}
+}
+
+func Test_channelAnalyzer_serveChannels(t *testing.T) {
+	a := newChannelAnalyzer(nil, nil, nil)
+	a.record(channelKey{pid: 100, addr: 0xc000010000}, "send", nil, time.Second, "chan int", nil)
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{name: "default limit", query: "", wantStatus: http.StatusOK},
+		{name: "limit", query: "?limit=5", wantStatus: http.StatusOK},
+		{name: "invalid limit", query: "?limit=abc", wantStatus: http.StatusBadRequest},
+		{name: "zero limit", query: "?limit=0", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			a.serveChannels(rec, httptest.NewRequest(http.MethodGet, "/channels"+tt.query, nil))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Contains(t, rec.Body.String(), `"type":"chan int"`)
+			}
+		})
+	}
+}
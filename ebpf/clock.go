@@ -0,0 +1,30 @@
+package ebpf
+
+import (
+	"log/slog"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ktimeNow returns the current CLOCK_MONOTONIC in nanoseconds, the clock of bpf_ktime_get_ns.
+func ktimeNow() uint64 {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		slog.Warn("Failed to read CLOCK_MONOTONIC", slog.Any("error", err))
+		return 0
+	}
+	return uint64(ts.Nano())
+}
+
+// timeFromKtime converts the nanoseconds of bpf_ktime_get_ns to the time.
+// The time is computed back from time.Now, so it keeps the monotonic clock reading of Go,
+// and the durations between the times are not affected by changes of the wall clock.
+func timeFromKtime(ktime uint64) time.Time {
+	now := time.Now()
+	current := ktimeNow()
+	if ktime == 0 || current < ktime {
+		return now
+	}
+	return now.Add(-time.Duration(current - ktime))
+}
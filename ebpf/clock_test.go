@@ -0,0 +1,19 @@
+package ebpf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_timeFromKtime(t *testing.T) {
+	ktime := ktimeNow()
+	assert.NotZero(t, ktime)
+	before := time.Now()
+	got := timeFromKtime(ktime - uint64(time.Second))
+	assert.InDelta(t, time.Second, before.Sub(got), float64(100*time.Millisecond))
+	// The time keeps the monotonic clock reading.
+	assert.InDelta(t, time.Second, time.Since(got), float64(100*time.Millisecond))
+	assert.WithinDuration(t, time.Now(), timeFromKtime(0), 100*time.Millisecond)
+}
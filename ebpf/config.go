@@ -2,26 +2,194 @@ package ebpf
 
 import (
 	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Values of the stack label mode.
+const (
+	// StackLabelModeFunction labels metrics with the function names of the stack.
+	StackLabelModeFunction = "function"
+	// StackLabelModeLocation labels metrics with the function names, files and line numbers of the stack.
+	StackLabelModeLocation = "location"
 )
 
 type Config struct {
-	binPath string
-	pid     int
+	targets          []Target
+	daemon           bool // monitor Go processes that start after gmon
+	followChildren   bool // monitor Go processes that the targets spawn
+	leakMaxAge       time.Duration
+	leakSiteMaxAge   map[string]time.Duration
+	leakGrowthWindow time.Duration
+	// reconcileInterval is the interval to evict goroutines that are not live in the processes. 0 disables it.
+	reconcileInterval time.Duration
+	lifetimeBuckets   []float64
+	ageBuckets        []float64
+	siteLabels        bool
+	stackLabelMode    string
+	waitReasons       bool // observe the time goroutines are blocked by wait reason
+	waitBuckets       []float64
+	channels          bool // analyze the time goroutines are blocked on channels
+	locks             bool // analyze the contention of sync.Mutex and sync.RWMutex
+	schedLatency      bool // observe the time goroutines are runnable until they get a P
+	schedBuckets      []float64
+	// retainTargetMetrics keeps the metrics of the targets after they exit.
+	retainTargetMetrics bool
+	mux                 *http.ServeMux        // serves the APIs
+	registerer          prometheus.Registerer // registers the metrics
 }
 
-func NewConfig(
-	binPath string,
-	Pid int,
-) (Config, error) {
+// Options are the options of NewConfig.
+type Options struct {
+	Targets []Target
+	// Daemon monitors Go processes that start after gmon.
+	Daemon bool
+	// FollowChildren monitors Go processes that the targets spawn. It requires the pids of the targets.
+	FollowChildren bool
+	// LeakMaxAge is the age of goroutines to be suspected as leaked. 0 disables the check.
+	LeakMaxAge time.Duration
+	// LeakSiteMaxAge overrides LeakMaxAge for goroutines whose creation stack has the function, keyed by the function.
+	LeakSiteMaxAge map[string]time.Duration
+	// LeakGrowthWindow is the window to detect creation sites whose goroutines keep growing. 0 disables the check.
+	LeakGrowthWindow time.Duration
+	// ReconcileInterval is the interval to evict goroutines that are not live in the processes. 0 disables it.
+	ReconcileInterval time.Duration
+	LifetimeBuckets   []float64
+	AgeBuckets        []float64
+	// SiteLabels labels metrics with the creation site of goroutines.
+	SiteLabels bool
+	// StackLabelMode is StackLabelModeFunction or StackLabelModeLocation.
+	StackLabelMode string
+	// WaitReasons observes the time goroutines are blocked by wait reason.
+	WaitReasons bool
+	// WaitBuckets are the buckets of the wait reasons and the lock contention.
+	WaitBuckets []float64
+	// Channels analyzes the time goroutines are blocked on channels.
+	Channels bool
+	// Locks analyzes the contention of sync.Mutex and sync.RWMutex.
+	Locks bool
+	// SchedLatency observes the time goroutines are runnable until they get a P.
+	SchedLatency bool
+	SchedBuckets []float64
+	// RetainTargetMetrics keeps the metrics of the targets after they exit, e.g. to summarize them with WriteSummary.
+	// The metrics of other processes are deleted when they exit.
+	RetainTargetMetrics bool
+	// Mux serves the APIs such as /goroutines. http.DefaultServeMux is used if nil.
+	Mux *http.ServeMux
+	// Registerer registers the metrics. prometheus.DefaultRegisterer is used if nil.
+	Registerer prometheus.Registerer
+}
+
+func NewConfig(opts Options) (Config, error) {
+	if len(opts.Targets) == 0 && !opts.Daemon {
+		return Config{}, fmt.Errorf("no targets")
+	}
+	if opts.FollowChildren {
+		if opts.Daemon {
+			return Config{}, fmt.Errorf("following child processes is redundant in the daemon mode")
+		}
+		for _, target := range opts.Targets {
+			if target.pid == 0 {
+				return Config{}, fmt.Errorf("following child processes requires the pid of %s", target)
+			}
+		}
+	}
+	if opts.LeakMaxAge < 0 {
+		return Config{}, fmt.Errorf("leak age threshold must not be negative: %s", opts.LeakMaxAge)
+	}
+	for site, maxAge := range opts.LeakSiteMaxAge {
+		if maxAge < 0 {
+			return Config{}, fmt.Errorf("leak age threshold of %s must not be negative: %s", site, maxAge)
+		}
+	}
+	if opts.LeakGrowthWindow < 0 {
+		return Config{}, fmt.Errorf("leak growth window must not be negative: %s", opts.LeakGrowthWindow)
+	}
+	if opts.ReconcileInterval < 0 {
+		return Config{}, fmt.Errorf("reconcile interval must not be negative: %s", opts.ReconcileInterval)
+	}
+	if err := validateBuckets(opts.LifetimeBuckets); err != nil {
+		return Config{}, fmt.Errorf("invalid lifetime buckets: %w", err)
+	}
+	if err := validateBuckets(opts.AgeBuckets); err != nil {
+		return Config{}, fmt.Errorf("invalid age buckets: %w", err)
+	}
+	if opts.WaitReasons || opts.Locks {
+		if err := validateBuckets(opts.WaitBuckets); err != nil {
+			return Config{}, fmt.Errorf("invalid wait buckets: %w", err)
+		}
+	}
+	if opts.SchedLatency {
+		if err := validateBuckets(opts.SchedBuckets); err != nil {
+			return Config{}, fmt.Errorf("invalid sched buckets: %w", err)
+		}
+	}
+	if opts.StackLabelMode != StackLabelModeFunction && opts.StackLabelMode != StackLabelModeLocation {
+		return Config{}, fmt.Errorf("unknown stack label mode %q", opts.StackLabelMode)
+	}
+	if opts.Mux == nil {
+		opts.Mux = http.DefaultServeMux
+	}
+	if opts.Registerer == nil {
+		opts.Registerer = prometheus.DefaultRegisterer
+	}
 	return Config{
-		binPath: binPath,
-		pid:     Pid,
+		targets:             opts.Targets,
+		daemon:              opts.Daemon,
+		followChildren:      opts.FollowChildren,
+		leakMaxAge:          opts.LeakMaxAge,
+		leakSiteMaxAge:      opts.LeakSiteMaxAge,
+		leakGrowthWindow:    opts.LeakGrowthWindow,
+		reconcileInterval:   opts.ReconcileInterval,
+		lifetimeBuckets:     opts.LifetimeBuckets,
+		ageBuckets:          opts.AgeBuckets,
+		siteLabels:          opts.SiteLabels,
+		stackLabelMode:      opts.StackLabelMode,
+		waitReasons:         opts.WaitReasons,
+		waitBuckets:         opts.WaitBuckets,
+		channels:            opts.Channels,
+		locks:               opts.Locks,
+		schedLatency:        opts.SchedLatency,
+		schedBuckets:        opts.SchedBuckets,
+		retainTargetMetrics: opts.RetainTargetMetrics,
+		mux:                 opts.Mux,
+		registerer:          opts.Registerer,
 	}, nil
 }
 
+func validateBuckets(buckets []float64) error {
+	if len(buckets) == 0 {
+		return fmt.Errorf("no buckets")
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return fmt.Errorf("buckets must be in increasing order: %v", buckets)
+		}
+	}
+	return nil
+}
+
 func (c Config) String() string {
-	return fmt.Sprintf("binPath: %s, pid: %d",
-		c.binPath,
-		c.pid,
+	return fmt.Sprintf("targets: %v, daemon: %t, followChildren: %t, leakMaxAge: %s, leakSiteMaxAge: %v, leakGrowthWindow: %s, reconcileInterval: %s, lifetimeBuckets: %v, ageBuckets: %v, siteLabels: %t, stackLabelMode: %s, waitReasons: %t, waitBuckets: %v, channels: %t, locks: %t, schedLatency: %t, schedBuckets: %v, retainTargetMetrics: %t",
+		c.targets,
+		c.daemon,
+		c.followChildren,
+		c.leakMaxAge,
+		c.leakSiteMaxAge,
+		c.leakGrowthWindow,
+		c.reconcileInterval,
+		c.lifetimeBuckets,
+		c.ageBuckets,
+		c.siteLabels,
+		c.stackLabelMode,
+		c.waitReasons,
+		c.waitBuckets,
+		c.channels,
+		c.locks,
+		c.schedLatency,
+		c.schedBuckets,
+		c.retainTargetMetrics,
 	)
 }
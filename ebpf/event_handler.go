@@ -11,32 +11,21 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/ringbuf"
-	"github.com/go-delve/delve/pkg/proc"
-	"github.com/hashicorp/golang-lru/v2/expirable"
 	"github.com/keisku/gmon/bininfo"
 )
 
 type eventHandler struct {
 	goroutineQueue chan<- goroutine
 	objs           *bpfObjects
-	biTranslator   bininfo.Translator
+	biTranslator   *bininfo.ProcessTranslator
 	reader         *ringbuf.Reader
+	stacks         *stackCache
 }
 
 func (h *eventHandler) run(ctx context.Context) {
 	var event bpfEvent
-	// To delete stack_addresses that is not used recently.
-	stackIdCache := expirable.NewLRU[int32, []*proc.Function](
-		32, // cache size
-		func(key int32, _ []*proc.Function) {
-			slog.Debug("delete stack_addresses", slog.Int("stack_id", int(key)))
-			if err := h.objs.StackAddresses.Delete(key); err != nil {
-				slog.Debug("Failed to delete stack_addresses", slog.Any("error", err))
-			}
-		},
-		time.Minute, // TTL of each cache entry
-	)
 	for {
 		if err := h.readRecord(ctx, &event); err != nil {
 			if errors.Is(err, ringbuf.ErrClosed) {
@@ -46,24 +35,22 @@ func (h *eventHandler) run(ctx context.Context) {
 			slog.Warn("Failed to read bpf ring buffer", slog.Any("error", err))
 			continue
 		}
-		var stack []*proc.Function
-		var ok bool
-		var err error
-		stack, ok = stackIdCache.Get(event.StackId)
-		if !ok {
-			stack, err = h.lookupStack(ctx, event.StackId)
-			if err != nil {
-				slog.Warn(err.Error())
-				continue
-			}
+		stack, err := h.stack(ctx, event.Pid, event.StackId)
+		if err != nil {
+			slog.Warn(err.Error())
+			continue
 		}
 		h.sendGoroutine(goroutine{
-			Id:         event.GoroutineId,
-			ObservedAt: time.Now(),
-			Stack:      stack,
-			Exit:       event.Exit,
+			Id:            event.GoroutineId,
+			ParentId:      event.ParentGoroutineId,
+			Pid:           event.Pid,
+			ObservedAt:    timeFromKtime(event.Ktime),
+			Ktime:         event.Ktime,
+			Stack:         stack,
+			CreatedBy:     h.lookupLocation(event.Pid, event.Gopc, true),
+			StartFunction: h.lookupLocation(event.Pid, event.Startpc, false),
+			Exit:          event.Exit,
 		})
-		_ = stackIdCache.Add(event.StackId, stack)
 	}
 }
 
@@ -80,45 +67,103 @@ func (h *eventHandler) readRecord(ctx context.Context, event *bpfEvent) error {
 	return nil
 }
 
+// readEvents decodes the records of the ring buffer and passes them to handle until the reader is closed.
+// name identifies the ring buffer in the logs.
+func readEvents[T any](reader *ringbuf.Reader, name string, handle func(T)) {
+	var event T
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, ringbuf.ErrClosed) {
+				slog.Debug("ring buffer is closed", slog.String("ring_buffer", name))
+				return
+			}
+			slog.Warn("Failed to read ring buffer", slog.String("ring_buffer", name), slog.Any("error", err))
+			continue
+		}
+		if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
+			slog.Warn("Failed to decode ring buffer record", slog.String("ring_buffer", name), slog.Any("error", err))
+			continue
+		}
+		handle(event)
+	}
+}
+
 // lookupStack is a copy of the function in tracee.
 // https://github.com/aquasecurity/tracee/blob/f61866b4e2277d2a7dddc6cd77a67cd5a5da3b14/pkg/ebpf/events_pipeline.go#L642-L681
 const maxStackDepth = 20
 
 var stackFrameSize = (strconv.IntSize / 8)
 
-func (h *eventHandler) lookupStack(ctx context.Context, stackId int32) ([]*proc.Function, error) {
+// stack returns the symbolized stack of stack_addresses through the cache shared by all the handlers,
+// which deletes the stacks that are not used recently from stack_addresses.
+func (h *eventHandler) stack(ctx context.Context, pid uint32, stackId int32) ([]location, error) {
+	return h.stacks.get(ctx, pid, stackId)
+}
+
+// lookupStack symbolizes the stack in stack_addresses for the process.
+func (h *eventHandler) lookupStack(ctx context.Context, pid uint32, stackId int32) ([]location, error) {
+	return h.lookupStackIn(ctx, h.objs.StackAddresses, pid, stackId)
+}
+
+// lookupStackIn symbolizes the stack in the stack trace map for the process.
+func (h *eventHandler) lookupStackIn(ctx context.Context, stacks *ebpf.Map, pid uint32, stackId int32) ([]location, error) {
 	_, task := trace.NewTask(ctx, "event_handler.lookup_stack")
 	defer task.End()
-	stackBytes, err := h.objs.StackAddresses.LookupBytes(stackId)
+	stackBytes, err := stacks.LookupBytes(stackId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to lookup stack addresses: %w", err)
 	}
 	if stackBytes == nil {
 		return nil, fmt.Errorf("bytes not found by stack_id=%d", stackId)
 	}
-	stack := make([]*proc.Function, maxStackDepth)
-	stackCounter := 0
+	stack := make([]location, 0, maxStackDepth)
 	for i := 0; i < len(stackBytes); i += stackFrameSize {
-		stackBytes[stackCounter] = 0
 		stackAddr := binary.LittleEndian.Uint64(stackBytes[i : i+stackFrameSize])
 		if stackAddr == 0 {
 			break
 		}
-		f := h.biTranslator.PCToFunc(stackAddr)
-		if f == nil {
-			// I don't know why, but a function address sometime should be last 3 bytes.
-			// At leaset, I observerd this behavior in the following binaries:
-			// - /usr/bin/dockerd
-			// - /usr/bin/containerd
-			f = h.biTranslator.PCToFunc(stackAddr & 0xffffff)
-			if f == nil {
-				f = &proc.Function{Name: fmt.Sprintf("%#x", stackAddr), Entry: stackAddr}
-			}
+		// The frames except the top one are return addresses.
+		retAddr := i > 0
+		ls := h.symbolize(pid, stackAddr, retAddr)
+		if ls == nil {
+			ls = []location{{PC: stackAddr, Function: fmt.Sprintf("%#x", stackAddr)}}
 		}
-		stack[stackCounter] = f
-		stackCounter++
+		stack = append(stack, ls...)
+	}
+	return stack, nil
+}
+
+// lookupLocation symbolizes the PC, or falls back to the hex address if the PC is unknown.
+// If retAddr is true, the PC is a return address and the call instruction is looked up instead.
+func (h *eventHandler) lookupLocation(pid uint32, pc uint64, retAddr bool) location {
+	if pc == 0 {
+		return location{}
+	}
+	ls := h.symbolize(pid, pc, retAddr)
+	if ls == nil {
+		return location{PC: pc, Function: fmt.Sprintf("%#x", pc)}
+	}
+	// The innermost frame is where the PC logically is, such as the function that has the go statement.
+	return ls[0]
+}
+
+// symbolize symbolizes the PC into the logical frames, innermost first, expanding inlined calls.
+// It returns nil if no function is found for the PC.
+func (h *eventHandler) symbolize(pid uint32, pc uint64, retAddr bool) []location {
+	tracepc := pc
+	if retAddr {
+		tracepc--
+	}
+	frames := h.biTranslator.PCToFrames(pid, tracepc)
+	if frames == nil {
+		return nil
+	}
+	ls := make([]location, len(frames))
+	for i, f := range frames {
+		ls[i] = location{PC: pc, Function: f.Function, File: f.File, Line: f.Line, Inlined: f.Inlined}
 	}
-	return stack[0:stackCounter], nil
+	return ls
 }
 
 func (h *eventHandler) sendGoroutine(g goroutine) {
@@ -131,6 +176,7 @@ func (h *eventHandler) sendGoroutine(g goroutine) {
 				slog.Info(
 					"goroutine is sent successfully after retries",
 					slog.Int("retry", attempts+1),
+					slog.Uint64("pid", uint64(g.Pid)),
 					slog.String("goroutine_id", fmt.Sprintf("%d", g.Id)),
 					slog.Bool("exit", g.Exit),
 					stackLogAttr(g.Stack),
@@ -143,6 +189,7 @@ func (h *eventHandler) sendGoroutine(g goroutine) {
 			} else {
 				slog.Warn(
 					"goroutine queue is full, retrying",
+					slog.Uint64("pid", uint64(g.Pid)),
 					slog.String("goroutine_id", fmt.Sprintf("%d", g.Id)),
 					slog.Bool("exit", g.Exit),
 					stackLogAttr(g.Stack),
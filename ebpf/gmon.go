@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 
 	"github.com/cilium/ebpf"
@@ -13,72 +14,137 @@ import (
 )
 
 // $BPF_CLANG and $BPF_CFLAGS are set by the Makefile.
-//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -type event -cc $BPF_CLANG -target amd64 -cflags $BPF_CFLAGS bpf ./c/gmon.c -- -I./c
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -type event -type process_event -type wait_event -type channel -type channel_key -type lock_event -type panic_event -type sched_event -cc $BPF_CLANG -target amd64 -cflags $BPF_CFLAGS bpf ./c/gmon.c -- -I./c
 
 func Run(ctx context.Context, config Config) (func(), error) {
 	slog.Debug("eBPF programs start with config", slog.String("config", config.String()))
-	objs := bpfObjects{}
-	if err := loadBpfObjects(&objs, nil); err != nil {
-		return func() {}, err
+	attacher := newAttacher(config)
+	// closers are closed in the reverse order when gmon stops or fails to start.
+	closers := []io.Closer{attacher}
+	closeAll := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			if err := closers[i].Close(); err != nil {
+				slog.Warn("Failed to close", slog.Any("error", err))
+			}
+		}
 	}
-	biTranslator, err := bininfo.NewTranslator(config.binPath)
-	if err != nil {
-		return func() {}, err
+	var attached []Target
+	for _, target := range config.targets {
+		if err := attacher.attach(target); err != nil {
+			if config.daemon {
+				slog.Warn("Failed to monitor the process", slog.String("target", target.String()), slog.Any("error", err))
+				continue
+			}
+			closeAll()
+			return func() {}, err
+		}
+		attached = append(attached, target)
 	}
-	ex, err := link.OpenExecutable(config.binPath)
+	// In the daemon mode, no targets may exist at startup.
+	shared, err := attacher.sharedObjects(bininfo.GLayout{})
 	if err != nil {
+		closeAll()
 		return func() {}, err
 	}
-	var links [2]link.Link
-	links[0], err = linkUprobe(
-		ex,
-		objs.RuntimeNewproc1,
-		"runtime.newproc1",
-		true,
-		config.pid,
-		biTranslator.Address,
-	)
-	if err != nil {
-		return func() {}, err
+	for _, tp := range []struct {
+		name    string
+		program *ebpf.Program
+	}{
+		{name: "sched_process_exec", program: shared.SchedProcessExec},
+		{name: "sched_process_exit", program: shared.SchedProcessExit},
+	} {
+		l, err := link.Tracepoint("sched", tp.name, tp.program, nil)
+		if err != nil {
+			closeAll()
+			return func() {}, fmt.Errorf("failed to attach tracepoint %s: %w", tp.name, err)
+		}
+		closers = append(closers, l)
 	}
-	links[1], err = linkUprobe(
-		ex,
-		objs.RuntimeGoexit1,
-		"runtime.goexit1",
-		false,
-		config.pid,
-		biTranslator.Address,
-	)
-	if err != nil {
-		return func() {}, err
+	if config.followChildren {
+		l, err := link.AttachRawTracepoint(link.RawTracepointOptions{Name: "sched_process_fork", Program: shared.SchedProcessFork})
+		if err != nil {
+			closeAll()
+			return func() {}, fmt.Errorf("failed to attach tracepoint sched_process_fork: %w", err)
+		}
+		closers = append(closers, l)
 	}
-	ringbufReader, err := ringbuf.NewReader(objs.Events)
-	if err != nil {
-		return func() {}, err
+	var ringbufReader, processReader, waitReader, lockReader, panicReader, schedReader *ringbuf.Reader
+	for _, r := range []struct {
+		reader **ringbuf.Reader
+		events *ebpf.Map
+	}{
+		{reader: &ringbufReader, events: shared.Events},
+		{reader: &processReader, events: shared.ProcessEvents},
+		{reader: &waitReader, events: shared.WaitEvents},
+		{reader: &lockReader, events: shared.LockEvents},
+		{reader: &panicReader, events: shared.PanicEvents},
+		{reader: &schedReader, events: shared.SchedEvents},
+	} {
+		*r.reader, err = ringbuf.NewReader(r.events)
+		if err != nil {
+			closeAll()
+			return func() {}, err
+		}
+		closers = append(closers, *r.reader)
 	}
 	goroutineQueue := make(chan goroutine, 100)
 	eventhandler := &eventHandler{
 		goroutineQueue: goroutineQueue,
-		objs:           &objs,
-		biTranslator:   biTranslator,
+		objs:           shared,
+		biTranslator:   attacher.processTranslator,
 		reader:         ringbufReader,
 	}
+	eventhandler.stacks = newStackCache(maxCachedStacks, eventhandler.lookupStack, func(id int32) error {
+		return shared.StackAddresses.Delete(id)
+	})
+	metrics := newMetrics(config.registerer, config)
 	reporter := &reporter{
 		goroutineQueue: goroutineQueue,
+		metrics:        metrics,
+		retainedPids:   make(map[uint32]bool),
 	}
-	go reporter.run(ctx)
-	go eventhandler.run(ctx)
-	return func() {
-		ringbufReader.Close()
-		for i := range links {
-			if err := links[i].Close(); err != nil {
-				slog.Warn("Failed to close link", slog.Any("error", err))
-			}
+	if config.retainTargetMetrics {
+		for _, target := range config.targets {
+			reporter.retainedPids[uint32(target.pid)] = true
 		}
-		if err := objs.Close(); err != nil {
-			slog.Warn("Failed to close bpf objects", slog.Any("error", err))
+	}
+	processWatcher := newProcessWatcher(attacher, reporter, processReader, config, func(target Target) {
+		go eventhandler.inventory(ctx, target)
+	})
+	config.registerer.MustRegister(newAgeCollector(reporter.liveGoroutines, metrics, config.ageBuckets))
+	leakDetector := newLeakDetector(reporter.liveGoroutines, metrics, config)
+	config.mux.HandleFunc("/goroutines", reporter.serveGoroutines)
+	config.mux.HandleFunc("/goroutines/tree", reporter.serveGoroutineTree)
+	config.mux.HandleFunc("/goroutines/leaks", leakDetector.serveLeakSuspects)
+	go reporter.run(ctx)
+	go leakDetector.run(ctx)
+	if config.waitReasons || config.channels {
+		var channels *channelAnalyzer
+		if config.channels {
+			channels = newChannelAnalyzer(shared, eventhandler, attacher)
+			config.mux.HandleFunc("/channels", channels.serveChannels)
 		}
-	}, nil
+		go newWaitHandler(waitReader, reporter, attacher, metrics, config, channels).run(ctx)
+	}
+	go newPanicHandler(panicReader, reporter, attacher, eventhandler, metrics).run(ctx)
+	if config.locks {
+		lockHandler := newLockHandler(lockReader, eventhandler, metrics)
+		config.mux.HandleFunc("/locks", lockHandler.serveLocks)
+		go lockHandler.run(ctx)
+	}
+	if config.schedLatency {
+		config.mux.HandleFunc("/goroutines/sched", reporter.serveSlowestScheduled)
+		go newSchedHandler(schedReader, reporter, metrics).run(ctx)
+	}
+	if config.reconcileInterval > 0 {
+		go newReconciler(reporter, attacher, config).run(ctx)
+	}
+	go eventhandler.run(ctx)
+	go processWatcher.run(ctx)
+	for _, target := range attached {
+		go eventhandler.inventory(ctx, target)
+	}
+	return closeAll, nil
 }
 
 func linkUprobe(
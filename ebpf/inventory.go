@@ -0,0 +1,55 @@
+package ebpf
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/keisku/gmon/bininfo"
+)
+
+// inventory sends the goroutines that the process of the target created before the attach to the reporter.
+// Their exits are observed by the uprobes like the goroutines created after the attach.
+// It is called after the attach so that no goroutine is missed in between.
+func (h *eventHandler) inventory(ctx context.Context, target Target) {
+	if target.pid == 0 {
+		// The processes running the executable are unknown.
+		return
+	}
+	layout, err := bininfo.NewGLayout(target.goObjectPath)
+	if err != nil {
+		slog.Warn("Failed to load runtime.g layout", slog.String("target", target.String()), slog.Any("error", err))
+		return
+	}
+	goroutines, err := bininfo.ReadGoroutines(target.pid, target.goObjectPath, layout)
+	if err != nil {
+		slog.Warn("Failed to read the goroutines created before the attach", slog.String("target", target.String()), slog.Any("error", err))
+		return
+	}
+	pid := uint32(target.pid)
+	ktime := ktimeNow()
+	now := timeFromKtime(ktime)
+	for _, g := range goroutines {
+		createdBy := h.lookupLocation(pid, g.Gopc, true)
+		var stack []location
+		if createdBy.PC != 0 {
+			stack = []location{createdBy}
+		}
+		select {
+		case h.goroutineQueue <- goroutine{
+			Id:            g.Id,
+			Pid:           pid,
+			ObservedAt:    now,
+			Ktime:         ktime,
+			Stack:         stack,
+			CreatedBy:     createdBy,
+			StartFunction: h.lookupLocation(pid, g.Startpc, false),
+			Preexisting:   true,
+		}:
+		case <-ctx.Done():
+			return
+		}
+	}
+	if len(goroutines) > 0 {
+		slog.Info("found goroutines created before the attach", slog.Int("pid", target.pid), slog.Int("goroutines", len(goroutines)))
+	}
+}
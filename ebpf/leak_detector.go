@@ -0,0 +1,215 @@
+package ebpf
+
+import (
+	"context"
+	"log/slog"
+	"runtime/trace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	leakReasonAge    = "age"
+	leakReasonGrowth = "growth"
+)
+
+var leakCheckInterval = 10 * time.Second
+
+// leakSuspect is a creation site that is suspected to leak goroutines.
+type leakSuspect struct {
+	site   creationSite
+	reason string
+	live   int
+	// suspected is the number of the live goroutines that are older than the age threshold,
+	// or that were created within the growth window.
+	suspected int
+	oldestAge time.Duration
+	threshold time.Duration
+	oldest    goroutine
+}
+
+// liveSample is the number of live goroutines of a creation site at a point in time.
+type liveSample struct {
+	at   time.Time
+	live int
+}
+
+// creationSite groups goroutines created by the same stack in the same process.
+type creationSite struct {
+	pid   uint32
+	stack string
+}
+
+func newCreationSite(g goroutine) creationSite {
+	names := make([]string, len(g.Stack))
+	for i, l := range g.Stack {
+		names[i] = l.String()
+	}
+	return creationSite{pid: g.Pid, stack: strings.Join(names, ";")}
+}
+
+// leakDetector flags creation sites whose goroutines live longer than a threshold,
+// or whose number of live goroutines keeps growing over a window.
+type leakDetector struct {
+	liveGoroutines func() []goroutine
+	metrics        *metrics
+	maxAge         time.Duration
+	siteMaxAge     map[string]time.Duration // keyed by a function name in the creation stack
+	growthWindow   time.Duration
+
+	mu       sync.Mutex
+	history  map[creationSite][]liveSample
+	suspects []leakSuspect
+}
+
+func newLeakDetector(liveGoroutines func() []goroutine, metrics *metrics, config Config) *leakDetector {
+	return &leakDetector{
+		liveGoroutines: liveGoroutines,
+		metrics:        metrics,
+		maxAge:         config.leakMaxAge,
+		siteMaxAge:     config.leakSiteMaxAge,
+		growthWindow:   config.leakGrowthWindow,
+		history:        make(map[creationSite][]liveSample),
+	}
+}
+
+func (d *leakDetector) run(ctx context.Context) {
+	ticker := time.NewTicker(leakCheckInterval)
+	for {
+		select {
+		case <-ctx.Done():
+			ticker.Stop()
+			return
+		case <-ticker.C:
+			_, task := trace.NewTask(ctx, "leak_detector.check")
+			d.check(time.Now(), d.liveGoroutines())
+			task.End()
+		}
+	}
+}
+
+// check updates the suspects with the live goroutines observed at now.
+func (d *leakDetector) check(now time.Time, gs []goroutine) {
+	sites := make(map[creationSite][]goroutine)
+	for _, g := range gs {
+		site := newCreationSite(g)
+		sites[site] = append(sites[site], g)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	type suspectKey struct {
+		site   creationSite
+		reason string
+	}
+	previous := make(map[suspectKey]bool, len(d.suspects))
+	for _, s := range d.suspects {
+		previous[suspectKey{site: s.site, reason: s.reason}] = true
+	}
+
+	var suspects []leakSuspect
+	for site, siteGs := range sites {
+		oldest := siteGs[0]
+		for _, g := range siteGs[1:] {
+			if g.ObservedAt.Before(oldest.ObservedAt) {
+				oldest = g
+			}
+		}
+		newSuspect := func(reason string, threshold time.Duration, isSuspected func(age time.Duration) bool) leakSuspect {
+			var suspected int
+			for _, g := range siteGs {
+				if isSuspected(now.Sub(g.ObservedAt)) {
+					suspected++
+				}
+			}
+			return leakSuspect{
+				site:      site,
+				reason:    reason,
+				live:      len(siteGs),
+				suspected: suspected,
+				oldestAge: now.Sub(oldest.ObservedAt),
+				threshold: threshold,
+				oldest:    oldest,
+			}
+		}
+
+		if maxAge := d.siteThreshold(oldest); maxAge > 0 && maxAge < now.Sub(oldest.ObservedAt) {
+			suspects = append(suspects, newSuspect(leakReasonAge, maxAge, func(age time.Duration) bool { return maxAge < age }))
+		}
+
+		samples := append(d.history[site], liveSample{at: now, live: len(siteGs)})
+		// Keep the oldest sample outside the window to know the growth over the whole window.
+		for 1 < len(samples) && now.Sub(samples[1].at) >= d.growthWindow {
+			samples = samples[1:]
+		}
+		d.history[site] = samples
+		if d.growthWindow > 0 && isGrowing(samples, d.growthWindow) {
+			suspects = append(suspects, newSuspect(leakReasonGrowth, d.growthWindow, func(age time.Duration) bool { return age < d.growthWindow }))
+		}
+	}
+	for site := range d.history {
+		if _, ok := sites[site]; !ok {
+			delete(d.history, site)
+		}
+	}
+
+	sort.Slice(suspects, func(i, j int) bool {
+		if suspects[i].site.pid != suspects[j].site.pid {
+			return suspects[i].site.pid < suspects[j].site.pid
+		}
+		return suspects[i].oldestAge > suspects[j].oldestAge
+	})
+	d.metrics.goroutineLeakSuspected.Reset()
+	for _, s := range suspects {
+		labels := d.metrics.goroutineLabels(s.oldest)
+		labels["reason"] = s.reason
+		// Sites that differ only below the top of the stack share the labels.
+		d.metrics.goroutineLeakSuspected.With(labels).Add(float64(s.suspected))
+		if previous[suspectKey{site: s.site, reason: s.reason}] {
+			continue
+		}
+		slog.Warn(
+			"goroutine leak is suspected",
+			slog.Uint64("pid", uint64(s.site.pid)),
+			slog.String("reason", s.reason),
+			slog.Int("live", s.live),
+			slog.Int("suspected", s.suspected),
+			slog.Duration("oldest_age", s.oldestAge),
+			slog.Duration("threshold", s.threshold),
+			stackLogAttr(s.oldest.Stack),
+		)
+	}
+	d.suspects = suspects
+}
+
+// siteThreshold returns the age threshold for the creation site of g.
+func (d *leakDetector) siteThreshold(g goroutine) time.Duration {
+	for _, l := range g.Stack {
+		if maxAge, ok := d.siteMaxAge[l.Function]; ok {
+			return maxAge
+		}
+	}
+	return d.maxAge
+}
+
+func (d *leakDetector) leakSuspects() []leakSuspect {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.suspects
+}
+
+// isGrowing reports whether the samples cover the window and the number of live goroutines never decreased and increased overall.
+func isGrowing(samples []liveSample, window time.Duration) bool {
+	if len(samples) < 2 || samples[len(samples)-1].at.Sub(samples[0].at) < window {
+		return false
+	}
+	for i := 1; i < len(samples); i++ {
+		if samples[i].live < samples[i-1].live {
+			return false
+		}
+	}
+	return samples[0].live < samples[len(samples)-1].live
+}
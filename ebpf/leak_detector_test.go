@@ -0,0 +1,95 @@
+package ebpf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_leakDetector_check(t *testing.T) {
+	now := time.Date(2024, 3, 20, 5, 10, 0, 0, time.UTC)
+	worker := []location{{PC: 0x1, Function: "runtime.newproc"}, {PC: 0x2, Function: "main.startWorker"}, {PC: 0x3, Function: "runtime.goexit"}}
+	handler := []location{{PC: 0x1, Function: "runtime.newproc"}, {PC: 0x4, Function: "main.handle", File: "/src/main.go", Line: 10}, {PC: 0x3, Function: "runtime.goexit"}}
+	d := &leakDetector{
+		metrics:      newTestMetrics(t, Config{}),
+		maxAge:       10 * time.Minute,
+		siteMaxAge:   map[string]time.Duration{"main.startWorker": time.Hour},
+		growthWindow: 2 * time.Minute,
+		history:      make(map[creationSite][]liveSample),
+	}
+
+	// A worker is allowed to live for an hour, but a handler is not.
+	d.check(now, []goroutine{
+		{Pid: 1, Id: 1, ObservedAt: now.Add(-30 * time.Minute), Stack: worker},
+		{Pid: 1, Id: 2, ObservedAt: now.Add(-30 * time.Minute), Stack: handler},
+		{Pid: 1, Id: 3, ObservedAt: now.Add(-time.Minute), Stack: handler},
+	})
+	suspects := d.leakSuspects()
+	if assert.Len(t, suspects, 1) {
+		assert.Equal(t, leakReasonAge, suspects[0].reason)
+		assert.Equal(t, handler, suspects[0].oldest.Stack)
+		assert.Equal(t, 2, suspects[0].live)
+		// Only the handler older than the threshold is suspected.
+		assert.Equal(t, 1, suspects[0].suspected)
+		assert.Equal(t, 30*time.Minute, suspects[0].oldestAge)
+		assert.Equal(t, 10*time.Minute, suspects[0].threshold)
+	}
+	assert.Equal(t, 1.0, testutil.ToFloat64(d.metrics.goroutineLeakSuspected))
+
+	// The number of workers keeps growing over the window.
+	var gs []goroutine
+	for i := range 3 {
+		at := now.Add(time.Duration(i) * time.Minute)
+		gs = append(gs, goroutine{Pid: 1, Id: int64(10 + i), ObservedAt: at, Stack: worker})
+		d.check(at, gs)
+	}
+	suspects = d.leakSuspects()
+	if assert.Len(t, suspects, 1) {
+		assert.Equal(t, leakReasonGrowth, suspects[0].reason)
+		assert.Equal(t, 3, suspects[0].live)
+		// The workers created within the window are suspected.
+		assert.Equal(t, 2, suspects[0].suspected)
+	}
+	assert.Equal(t, 2.0, testutil.ToFloat64(d.metrics.goroutineLeakSuspected))
+
+	// The workers stop growing.
+	d.check(now.Add(3*time.Minute), gs[:1])
+	assert.Empty(t, d.leakSuspects())
+}
+
+func Test_isGrowing(t *testing.T) {
+	now := time.Date(2024, 3, 20, 5, 10, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		samples []liveSample
+		want    bool
+	}{
+		{
+			name:    "growing over the window",
+			samples: []liveSample{{at: now, live: 1}, {at: now.Add(time.Minute), live: 1}, {at: now.Add(2 * time.Minute), live: 3}},
+			want:    true,
+		},
+		{
+			name:    "not covering the window",
+			samples: []liveSample{{at: now, live: 1}, {at: now.Add(time.Minute), live: 3}},
+			want:    false,
+		},
+		{
+			name:    "decreased once",
+			samples: []liveSample{{at: now, live: 1}, {at: now.Add(time.Minute), live: 0}, {at: now.Add(2 * time.Minute), live: 3}},
+			want:    false,
+		},
+		{
+			name:    "flat",
+			samples: []liveSample{{at: now, live: 3}, {at: now.Add(2 * time.Minute), live: 3}},
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isGrowing(tt.samples, 2*time.Minute))
+		})
+	}
+}
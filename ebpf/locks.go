@@ -0,0 +1,195 @@
+package ebpf
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf/ringbuf"
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+const (
+	// maxLocks bounds the number of locks whose contention is analyzed. The least recently contended ones are dropped.
+	maxLocks = 4096
+	// rwmutexWriterSemOffset and rwmutexReaderSemOffset are the offsets of sync.RWMutex.writerSem and readerSem,
+	// which are passed to the semaphores instead of the RWMutex.
+	// https://github.com/golang/go/blob/release-branch.go1.23/src/sync/rwmutex.go#L35
+	rwmutexWriterSemOffset = 8
+	rwmutexReaderSemOffset = 12
+)
+
+// Values of enum lock_op.
+const (
+	lockOpMutex = iota + 1
+	lockOpRLock
+	lockOpWLock
+	unlockOpMutex
+	unlockOpRUnlock
+)
+
+// lockOps are the names of enum lock_op.
+var lockOps = []string{"", "lock", "rlock", "lock_readers", "unlock", "runlock"}
+
+func lockOpName(op uint8) string {
+	if int(op) < len(lockOps) {
+		return lockOps[op]
+	}
+	return strconv.Itoa(int(op))
+}
+
+// lockKey identifies a sync.Mutex or a sync.RWMutex across processes.
+type lockKey struct {
+	pid  uint32
+	addr uint64
+}
+
+// lockStat is the contention of a lock.
+type lockStat struct {
+	Pid            uint32        `json:"pid"`
+	Address        string        `json:"address"`
+	Type           string        `json:"type"`
+	BlockedSeconds float64       `json:"blocked_seconds"`
+	Waits          int           `json:"waits"`
+	Wakeups        int           `json:"wakeups"` // unlocks that woke up waiters
+	Waiters        []*waiterSite `json:"waiters"`
+	Wakers         []*waiterSite `json:"wakers"`
+	blocked        time.Duration
+	waiters        waiterSites
+	wakers         waiterSites
+}
+
+// lockHandler measures the time that goroutines waited for contended sync.Mutex and sync.RWMutex
+// by lock and call site, and the unlocks that woke up the waiters.
+type lockHandler struct {
+	reader       *ringbuf.Reader
+	eventHandler *eventHandler
+	metrics      *metrics
+
+	mu    sync.Mutex
+	locks *lru.Cache[lockKey, *lockStat]
+}
+
+func newLockHandler(reader *ringbuf.Reader, eventHandler *eventHandler, metrics *metrics) *lockHandler {
+	locks, err := lru.New[lockKey, *lockStat](maxLocks)
+	if err != nil {
+		// The size is a positive constant.
+		panic(err)
+	}
+	return &lockHandler{
+		reader:       reader,
+		eventHandler: eventHandler,
+		metrics:      metrics,
+		locks:        locks,
+	}
+}
+
+func (h *lockHandler) run(ctx context.Context) {
+	readEvents(h.reader, "lock", func(event bpfLockEvent) {
+		var stack []location
+		if event.StackId >= 0 {
+			var err error
+			stack, err = h.eventHandler.stack(ctx, event.Pid, event.StackId)
+			if err != nil {
+				slog.Debug("failed to look up the stack of the lock event", slog.Any("error", err))
+			}
+		}
+		h.observe(event, stack)
+	})
+}
+
+// observe records the lock event with the stack of the goroutine.
+func (h *lockHandler) observe(event bpfLockEvent, stack []location) {
+	key := lockKey{pid: event.Pid, addr: event.Lock}
+	typ := "sync.Mutex"
+	switch event.Op {
+	case lockOpRLock:
+		key.addr -= rwmutexReaderSemOffset
+		typ = "sync.RWMutex"
+	case lockOpWLock:
+		key.addr -= rwmutexWriterSemOffset
+		typ = "sync.RWMutex"
+	case unlockOpRUnlock:
+		typ = "sync.RWMutex"
+	}
+	site := callSite(stack)
+	op := lockOpName(event.Op)
+	blocked := time.Duration(event.DurationNs)
+	labels := h.metrics.lockLabels(event.Pid, op, site)
+	if event.Op == unlockOpMutex || event.Op == unlockOpRUnlock {
+		h.metrics.lockWakeup.With(labels).Inc()
+	} else {
+		h.metrics.lockWait.With(labels).Observe(blocked.Seconds())
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stat, ok := h.locks.Get(key)
+	if !ok {
+		stat = &lockStat{
+			Pid:     key.pid,
+			Address: fmt.Sprintf("%#x", key.addr),
+			Type:    typ,
+			waiters: make(waiterSites),
+			wakers:  make(waiterSites),
+		}
+		h.locks.Add(key, stat)
+	}
+	if typ == "sync.RWMutex" {
+		// The writers of a sync.RWMutex are observed as a sync.Mutex until a reader is observed.
+		stat.Type = typ
+	}
+	if event.Op == unlockOpMutex || event.Op == unlockOpRUnlock {
+		stat.Wakeups++
+		stat.wakers.add(op, site, 0)
+		return
+	}
+	stat.blocked += blocked
+	stat.Waits++
+	stat.waiters.add(op, site, blocked)
+}
+
+// topLocks returns the locks that goroutines waited for the longest, up to limit.
+func (h *lockHandler) topLocks(limit int) []lockStat {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stats := make([]lockStat, 0, h.locks.Len())
+	for _, s := range h.locks.Values() {
+		stat := *s
+		stat.BlockedSeconds = s.blocked.Seconds()
+		stat.Waiters = s.waiters.sorted()
+		stat.Wakers = s.wakers.sorted()
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].blocked != stats[j].blocked {
+			return stats[i].blocked > stats[j].blocked
+		}
+		if stats[i].Pid != stats[j].Pid {
+			return stats[i].Pid < stats[j].Pid
+		}
+		return stats[i].Address < stats[j].Address
+	})
+	if len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats
+}
+
+// callSite drops the frames of the sync package and the Go runtime from the top of the stack,
+// so that the top is the function that locks or unlocks.
+func callSite(stack []location) []location {
+	for i, l := range stack {
+		if !strings.HasPrefix(l.Function, "sync.") &&
+			!strings.HasPrefix(l.Function, "internal/sync.") &&
+			!strings.HasPrefix(l.Function, "runtime.") {
+			return stack[i:]
+		}
+	}
+	return nil
+}
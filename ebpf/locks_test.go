@@ -0,0 +1,79 @@
+package ebpf
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_lockHandler_observe(t *testing.T) {
+	config := Config{locks: true, waitBuckets: []float64{0.1, 1}}
+	metrics := newTestMetrics(t, config)
+	h := newLockHandler(nil, nil, metrics)
+	lock := []location{
+		{PC: 0x10, Function: "internal/sync.(*Mutex).lockSlow"},
+		{PC: 0x10, Function: "sync.(*Mutex).Lock", Inlined: true},
+		{PC: 0x20, Function: "main.(*cache).get"},
+		{PC: 0x30, Function: "main.main"},
+	}
+	rlock := []location{
+		{PC: 0x40, Function: "sync.runtime_SemacquireRWMutexR"},
+		{PC: 0x50, Function: "main.(*cache).read"},
+	}
+	unlock := []location{
+		{PC: 0x60, Function: "internal/sync.(*Mutex).unlockSlow"},
+		{PC: 0x70, Function: "main.(*cache).put"},
+	}
+
+	for _, e := range []struct {
+		event bpfLockEvent
+		stack []location
+	}{
+		{event: bpfLockEvent{Pid: 100, Lock: 0xc000010000, Op: lockOpMutex, DurationNs: uint64(500 * time.Millisecond)}, stack: lock},
+		{event: bpfLockEvent{Pid: 100, Lock: 0xc000010000, Op: lockOpMutex, DurationNs: uint64(2 * time.Second)}, stack: lock},
+		// The reader waits on the readerSem of the same RWMutex.
+		{event: bpfLockEvent{Pid: 100, Lock: 0xc000010000 + rwmutexReaderSemOffset, Op: lockOpRLock, DurationNs: uint64(time.Second)}, stack: rlock},
+		{event: bpfLockEvent{Pid: 100, Lock: 0xc000010000, Op: unlockOpMutex}, stack: unlock},
+		{event: bpfLockEvent{Pid: 100, Lock: 0xc000020000, Op: lockOpMutex, DurationNs: uint64(time.Millisecond)}, stack: lock},
+	} {
+		h.observe(e.event, e.stack)
+	}
+
+	want := `
+# HELP gmon_lock_wait_seconds Time in seconds that goroutines waited for contended sync.Mutex and sync.RWMutex, by lock operation and call site
+# TYPE gmon_lock_wait_seconds histogram
+gmon_lock_wait_seconds_bucket{lock_op="lock",pid="100",stack_0="main.main",stack_1="main.(*cache).get",stack_2="none",stack_3="none",stack_4="none",le="0.1"} 1
+gmon_lock_wait_seconds_bucket{lock_op="lock",pid="100",stack_0="main.main",stack_1="main.(*cache).get",stack_2="none",stack_3="none",stack_4="none",le="1"} 2
+gmon_lock_wait_seconds_bucket{lock_op="lock",pid="100",stack_0="main.main",stack_1="main.(*cache).get",stack_2="none",stack_3="none",stack_4="none",le="+Inf"} 3
+gmon_lock_wait_seconds_sum{lock_op="lock",pid="100",stack_0="main.main",stack_1="main.(*cache).get",stack_2="none",stack_3="none",stack_4="none"} 2.501
+gmon_lock_wait_seconds_count{lock_op="lock",pid="100",stack_0="main.main",stack_1="main.(*cache).get",stack_2="none",stack_3="none",stack_4="none"} 3
+gmon_lock_wait_seconds_bucket{lock_op="rlock",pid="100",stack_0="main.(*cache).read",stack_1="none",stack_2="none",stack_3="none",stack_4="none",le="0.1"} 0
+gmon_lock_wait_seconds_bucket{lock_op="rlock",pid="100",stack_0="main.(*cache).read",stack_1="none",stack_2="none",stack_3="none",stack_4="none",le="1"} 1
+gmon_lock_wait_seconds_bucket{lock_op="rlock",pid="100",stack_0="main.(*cache).read",stack_1="none",stack_2="none",stack_3="none",stack_4="none",le="+Inf"} 1
+gmon_lock_wait_seconds_sum{lock_op="rlock",pid="100",stack_0="main.(*cache).read",stack_1="none",stack_2="none",stack_3="none",stack_4="none"} 1
+gmon_lock_wait_seconds_count{lock_op="rlock",pid="100",stack_0="main.(*cache).read",stack_1="none",stack_2="none",stack_3="none",stack_4="none"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(metrics.lockWait, strings.NewReader(want)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.lockWakeup))
+
+	got := h.topLocks(10)
+	require.Len(t, got, 2)
+	assert.Equal(t, "0xc000010000", got[0].Address)
+	assert.Equal(t, "sync.RWMutex", got[0].Type)
+	assert.InDelta(t, 3.5, got[0].BlockedSeconds, 1e-9)
+	assert.Equal(t, 3, got[0].Waits)
+	assert.Equal(t, 1, got[0].Wakeups)
+	require.Len(t, got[0].Waiters, 2)
+	assert.Equal(t, "lock", got[0].Waiters[0].Op)
+	assert.Equal(t, "main.(*cache).get", got[0].Waiters[0].Stack[0].Function)
+	assert.Equal(t, "rlock", got[0].Waiters[1].Op)
+	require.Len(t, got[0].Wakers, 1)
+	assert.Equal(t, "main.(*cache).put", got[0].Wakers[0].Stack[0].Function)
+	assert.Equal(t, "0xc000020000", got[1].Address)
+	assert.Equal(t, "sync.Mutex", got[1].Type)
+	assert.Len(t, h.topLocks(1), 1)
+}
@@ -0,0 +1,262 @@
+package ebpf
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	namespace      = "gmon"
+	stackLabelKeys = []string{"stack_0", "stack_1", "stack_2", "stack_3", "stack_4"} // 0 is the top
+	siteLabelKeys  = []string{"created_by", "start_function"}
+	lockLabelKeys  = append([]string{"lock_op", "pid"}, stackLabelKeys...)
+)
+
+// metrics holds the Prometheus metrics labelled by goroutine.
+// The label keys depend on the config, so the metrics are created at runtime.
+type metrics struct {
+	labelKeys                []string
+	ppidLabel                bool
+	siteLabels               bool
+	stackLabelLocation       bool
+	goroutineCreation        *prometheus.CounterVec
+	goroutineExit            *prometheus.CounterVec
+	goroutinePreexisting     *prometheus.CounterVec
+	goroutineReconciled      *prometheus.CounterVec
+	goroutineLive            *prometheus.GaugeVec
+	processGoroutines        *prometheus.GaugeVec
+	goroutineLifetime        *prometheus.HistogramVec
+	goroutineWait            *prometheus.HistogramVec
+	goroutineSchedLatency    *prometheus.HistogramVec
+	goroutineLeakSuspected   *prometheus.GaugeVec
+	goroutinePanics          *prometheus.CounterVec
+	goroutinePanicsRecovered *prometheus.CounterVec
+	lockWait                 *prometheus.HistogramVec
+	lockWakeup               *prometheus.CounterVec
+}
+
+func newMetrics(reg prometheus.Registerer, config Config) *metrics {
+	labelKeys := []string{"pid"}
+	if config.followChildren {
+		labelKeys = append(labelKeys, "ppid")
+	}
+	labelKeys = append(labelKeys, stackLabelKeys...)
+	if config.siteLabels {
+		labelKeys = append(labelKeys, siteLabelKeys...)
+	}
+	factory := promauto.With(reg)
+	return &metrics{
+		labelKeys:          labelKeys,
+		ppidLabel:          config.followChildren,
+		siteLabels:         config.siteLabels,
+		stackLabelLocation: config.stackLabelMode == StackLabelModeLocation,
+		goroutineCreation: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "goroutine_creation",
+				Help:      "The number of goroutines that have been creaated",
+			},
+			labelKeys,
+		),
+		goroutineExit: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "goroutine_exit",
+				Help:      "The number of goroutines that have been exited",
+			},
+			labelKeys,
+		),
+		goroutinePreexisting: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "goroutine_preexisting",
+				Help:      "The number of goroutines that had been created before gmon attached to the process",
+			},
+			labelKeys,
+		),
+		goroutineReconciled: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "goroutine_reconciled",
+				Help:      "The number of goroutines that were evicted since they were not live in the process, e.g. due to lost exit events",
+			},
+			labelKeys,
+		),
+		goroutineLive: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "goroutine_live",
+				Help:      "The number of live goroutines",
+			},
+			labelKeys,
+		),
+		processGoroutines: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "goroutines",
+				Help:      "The number of live goroutines in the process",
+			},
+			[]string{"pid"},
+		),
+		goroutineLifetime: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "goroutine_lifetime",
+				Help:      "Lifetime of exited goroutines in seconds",
+				Buckets:   config.lifetimeBuckets,
+			},
+			labelKeys,
+		),
+		goroutineWait: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "goroutine_wait_seconds",
+				Help:      "Time in seconds that goroutines were blocked until they became runnable, by wait reason",
+				Buckets:   config.waitBuckets,
+			},
+			append([]string{"wait_reason"}, labelKeys...),
+		),
+		goroutineSchedLatency: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "goroutine_sched_latency_seconds",
+				Help:      "Time in seconds that goroutines were runnable until they got a P",
+				Buckets:   config.schedBuckets,
+			},
+			labelKeys,
+		),
+		goroutineLeakSuspected: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "goroutine_leak_suspected",
+				Help:      "The number of live goroutines of a suspected creation site that are older than the age threshold or were created within the growth window",
+			},
+			append([]string{"reason"}, labelKeys...),
+		),
+		goroutinePanics: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "goroutine_panics_total",
+				Help:      "The number of panics of goroutines by the creation site",
+			},
+			labelKeys,
+		),
+		goroutinePanicsRecovered: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "goroutine_panics_recovered_total",
+				Help:      "The number of panics of goroutines that have been recovered by the creation site",
+			},
+			labelKeys,
+		),
+		lockWait: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "lock_wait_seconds",
+				Help:      "Time in seconds that goroutines waited for contended sync.Mutex and sync.RWMutex, by lock operation and call site",
+				Buckets:   config.waitBuckets,
+			},
+			lockLabelKeys,
+		),
+		lockWakeup: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "lock_wakeup",
+				Help:      "The number of unlocks of sync.Mutex and sync.RWMutex that woke up waiting goroutines, by unlock operation and call site",
+			},
+			lockLabelKeys,
+		),
+	}
+}
+
+// deleteProcess deletes the series of the process from the metrics labelled by pid.
+func (m *metrics) deleteProcess(pid uint32) {
+	labels := prometheus.Labels{"pid": strconv.FormatUint(uint64(pid), 10)}
+	for _, vec := range []interface {
+		DeletePartialMatch(prometheus.Labels) int
+	}{
+		m.goroutineCreation,
+		m.goroutineExit,
+		m.goroutinePreexisting,
+		m.goroutineReconciled,
+		m.goroutineLive,
+		m.processGoroutines,
+		m.goroutineLifetime,
+		m.goroutineWait,
+		m.goroutineSchedLatency,
+		m.goroutineLeakSuspected,
+		m.goroutinePanics,
+		m.goroutinePanicsRecovered,
+		m.lockWait,
+		m.lockWakeup,
+	} {
+		vec.DeletePartialMatch(labels)
+	}
+}
+
+// goroutineLabels generates a set of Prometheus labels for the process, the stack and optionally the parent process and the creation site of the goroutine.
+func (m *metrics) goroutineLabels(g goroutine) prometheus.Labels {
+	labels := stackLabels(g.Stack, m.stackLabelLocation)
+	labels["pid"] = strconv.FormatUint(uint64(g.Pid), 10)
+	if m.ppidLabel {
+		// The label is empty for the processes that are not followed child processes.
+		labels["ppid"] = ""
+		if g.Ppid != 0 {
+			labels["ppid"] = strconv.FormatUint(uint64(g.Ppid), 10)
+		}
+	}
+	if m.siteLabels {
+		labels["created_by"] = g.CreatedBy.Function
+		labels["start_function"] = g.StartFunction.Function
+	}
+	return labels
+}
+
+// lockLabels generates a set of Prometheus labels for the lock operation and the innermost functions of the call site.
+func (m *metrics) lockLabels(pid uint32, op string, site []location) prometheus.Labels {
+	if len(site) > len(stackLabelKeys) {
+		site = site[:len(stackLabelKeys)]
+	}
+	labels := stackLabels(site, m.stackLabelLocation)
+	labels["pid"] = strconv.FormatUint(uint64(pid), 10)
+	labels["lock_op"] = op
+	return labels
+}
+
+// processLabels generates a set of Prometheus labels for the process of the goroutine.
+func processLabels(g goroutine) prometheus.Labels {
+	return prometheus.Labels{"pid": strconv.FormatUint(uint64(g.Pid), 10)}
+}
+
+// stackLabels generates a set of Prometheus labels for the top functions in the stack.
+// If withLine is true, the labels have the file and line numbers in addition to the function names.
+// If the stack has fewer than expected functions, it fills the remaining labels with "none".
+func stackLabels(stack []location, withLine bool) prometheus.Labels {
+	labels := prometheus.Labels{}
+
+	// Ensure to only process the top 5 elements, or the stack length if shorter.
+	topN := len(stack)
+	if topN > len(stackLabelKeys) {
+		topN = len(stackLabelKeys)
+	}
+
+	for i := 0; i < len(stackLabelKeys); i++ {
+		labelKey := fmt.Sprintf("stack_%d", i)
+		if i < topN {
+			// Stack is reversed, so we start from the end of the slice.
+			l := stack[len(stack)-1-i]
+			if withLine {
+				labels[labelKey] = l.String()
+			} else {
+				labels[labelKey] = l.Function
+			}
+		} else {
+			labels[labelKey] = "none"
+		}
+	}
+
+	return labels
+}
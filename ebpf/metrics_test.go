@@ -0,0 +1,116 @@
+package ebpf
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestMetrics returns the metrics of the config, registered to a new registry unless the config has one.
+// The lifetime histogram has a single bucket unless the config has the buckets.
+func newTestMetrics(t *testing.T, config Config) *metrics {
+	t.Helper()
+	if config.registerer == nil {
+		config.registerer = prometheus.NewRegistry()
+	}
+	if config.lifetimeBuckets == nil {
+		config.lifetimeBuckets = []float64{1}
+	}
+	return newMetrics(config.registerer, config)
+}
+
+func Test_stackLabels(t *testing.T) {
+	type args struct {
+		stack    []location
+		withLine bool
+	}
+	tests := []struct {
+		name string
+		args args
+		want prometheus.Labels
+	}{
+		{
+			name: "stack length is 5",
+			args: args{
+				stack: []location{
+					{Function: "func1"},
+					{Function: "func2"},
+					{Function: "func3"},
+					{Function: "func4"},
+					{Function: "func5"},
+				},
+			},
+			want: prometheus.Labels{
+				"stack_0": "func5",
+				"stack_1": "func4",
+				"stack_2": "func3",
+				"stack_3": "func2",
+				"stack_4": "func1",
+			},
+		},
+		{
+			name: "stack length is 3",
+			args: args{
+				stack: []location{
+					{Function: "func1"},
+					{Function: "func2"},
+					{Function: "func3"},
+				},
+			},
+			want: prometheus.Labels{
+				"stack_0": "func3",
+				"stack_1": "func2",
+				"stack_2": "func1",
+				"stack_3": "none",
+				"stack_4": "none",
+			},
+		},
+		{
+			name: "with line numbers",
+			args: args{
+				stack: []location{
+					{Function: "func1", File: "/src/main.go", Line: 10},
+					{Function: "func2"},
+				},
+				withLine: true,
+			},
+			want: prometheus.Labels{
+				"stack_0": "func2",
+				"stack_1": "func1 /src/main.go:10",
+				"stack_2": "none",
+				"stack_3": "none",
+				"stack_4": "none",
+			},
+		},
+		{
+			name: "stack length is 10",
+			args: args{
+				stack: []location{
+					{Function: "func1"},
+					{Function: "func2"},
+					{Function: "func3"},
+					{Function: "func4"},
+					{Function: "func5"},
+					{Function: "func6"},
+					{Function: "func7"},
+					{Function: "func8"},
+					{Function: "func9"},
+					{Function: "func10"},
+				},
+			},
+			want: prometheus.Labels{
+				"stack_0": "func10",
+				"stack_1": "func9",
+				"stack_2": "func8",
+				"stack_3": "func7",
+				"stack_4": "func6",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, stackLabels(tt.args.stack, tt.args.withLine))
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package ebpf
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/cilium/ebpf/ringbuf"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// Values of enum panic_kind.
+const (
+	panicStart = iota + 1
+	panicRecovered
+	panicFatal
+)
+
+// goroutinePanic is a panic of a goroutine until it is recovered or crashes the process.
+type goroutinePanic struct {
+	goroutine goroutine // the creation context of the goroutine, or only the ids if the goroutine is unknown
+	stack     []location
+	value     string
+}
+
+// panicHandler logs the panics of goroutines with the sites where the goroutines were created,
+// and counts them by creation site.
+type panicHandler struct {
+	reader       *ringbuf.Reader
+	reporter     *reporter
+	attacher     *attacher
+	eventHandler *eventHandler
+	metrics      *metrics
+	// panics are the panics that have not been recovered or crashed the process yet.
+	panics *expirable.LRU[goroutineKey, goroutinePanic]
+}
+
+func newPanicHandler(reader *ringbuf.Reader, reporter *reporter, attacher *attacher, eventHandler *eventHandler, metrics *metrics) *panicHandler {
+	return &panicHandler{
+		reader:       reader,
+		reporter:     reporter,
+		attacher:     attacher,
+		eventHandler: eventHandler,
+		metrics:      metrics,
+		panics: expirable.NewLRU[goroutineKey, goroutinePanic](
+			1024, // cache size
+			nil,
+			10*time.Minute, // TTL of each cache entry
+		),
+	}
+}
+
+func (h *panicHandler) run(ctx context.Context) {
+	readEvents(h.reader, "panic", func(event bpfPanicEvent) {
+		var stack []location
+		if event.Kind == panicStart && event.StackId >= 0 {
+			var err error
+			stack, err = h.eventHandler.stack(ctx, event.Pid, event.StackId)
+			if err != nil {
+				slog.Debug("failed to look up the stack of the panic", slog.Any("error", err))
+			}
+		}
+		h.observe(event, stack, h.panicValue(event))
+	})
+}
+
+// observe logs the panic event and counts the panic by the creation site of the goroutine.
+// stack and value are only used for the start of a panic.
+func (h *panicHandler) observe(event bpfPanicEvent, stack []location, value string) {
+	key := goroutineKey{pid: event.Pid, goid: event.GoroutineId}
+	switch event.Kind {
+	case panicStart:
+		// The goroutine is looked up now since it is forgotten when the panic crashes the process.
+		g, ok := h.reporter.goroutine(key)
+		if !ok {
+			g = goroutine{Id: event.GoroutineId, Pid: event.Pid}
+		}
+		p := goroutinePanic{goroutine: g, stack: stack, value: value}
+		// A panic during a panic replaces the previous one.
+		h.panics.Add(key, p)
+		h.metrics.goroutinePanics.With(h.metrics.goroutineLabels(g)).Inc()
+		slog.Warn("goroutine panics", p.logAttrs()...)
+	case panicRecovered:
+		p, ok := h.panics.Get(key)
+		if !ok {
+			return
+		}
+		h.panics.Remove(key)
+		h.metrics.goroutinePanicsRecovered.With(h.metrics.goroutineLabels(p.goroutine)).Inc()
+		slog.Info("goroutine recovered from the panic", p.logAttrs()...)
+	case panicFatal:
+		p, ok := h.panics.Get(key)
+		if !ok {
+			p = goroutinePanic{goroutine: goroutine{Id: event.GoroutineId, Pid: event.Pid}}
+		}
+		h.panics.Remove(key)
+		slog.Error("goroutine panic crashes the process", p.logAttrs()...)
+	}
+}
+
+func (p goroutinePanic) logAttrs() []any {
+	return []any{
+		slog.Uint64("pid", uint64(p.goroutine.Pid)),
+		slog.Int64("goroutine_id", p.goroutine.Id),
+		slog.String("value", p.value),
+		slog.String("created_by", p.goroutine.CreatedBy.String()),
+		slog.Group("creation", stackLogAttr(p.goroutine.Stack)),
+		slog.Group("panic", stackLogAttr(p.stack)),
+	}
+}
+
+// panicValue returns the type of the panic value, followed by the message if the value is a string.
+func (h *panicHandler) panicValue(event bpfPanicEvent) string {
+	if event.Kind != panicStart || event.ValueType == 0 {
+		return ""
+	}
+	name, ok := h.typeName(event.Pid, event.ValueType)
+	if !ok {
+		return ""
+	}
+	if name != "string" || event.MessageLen == 0 {
+		return name
+	}
+	message := make([]byte, min(int(event.MessageLen), len(event.Message)))
+	for i := range message {
+		message[i] = byte(event.Message[i])
+	}
+	return name + ": " + string(message)
+}
+
+// typeName returns the name of the type whose runtime type descriptor is at the address in the process.
+func (h *panicHandler) typeName(pid uint32, addr uint64) (string, bool) {
+	object, path, ok := h.attacher.goObject(int(pid))
+	if !ok {
+		return "", false
+	}
+	return object.typeName(int(pid), path, addr)
+}
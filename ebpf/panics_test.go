@@ -0,0 +1,49 @@
+package ebpf
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_panicHandler_observe(t *testing.T) {
+	config := Config{}
+	metrics := newTestMetrics(t, config)
+	r := &reporter{metrics: metrics}
+	r.storeGoroutine(context.Background(), goroutine{
+		Id:         1,
+		Pid:        100,
+		ObservedAt: time.Now(),
+		Stack:      []location{{PC: 0x10, Function: "main.startWorker"}, {PC: 0x20, Function: "main.main"}},
+	})
+	h := newPanicHandler(nil, r, newAttacher(config), nil, metrics)
+	panicStack := []location{{PC: 0x30, Function: "main.worker"}}
+
+	for _, event := range []bpfPanicEvent{
+		{GoroutineId: 1, Pid: 100, Kind: panicStart},
+		{GoroutineId: 1, Pid: 100, Kind: panicRecovered},
+		// The recovery of a goroutine that has not panicked is ignored.
+		{GoroutineId: 1, Pid: 100, Kind: panicRecovered},
+		{GoroutineId: 1, Pid: 100, Kind: panicStart},
+		{GoroutineId: 1, Pid: 100, Kind: panicFatal},
+		// The goroutine is unknown.
+		{GoroutineId: 2, Pid: 100, Kind: panicStart},
+	} {
+		h.observe(event, panicStack, "string: boom")
+	}
+
+	want := `
+# HELP gmon_goroutine_panics_total The number of panics of goroutines by the creation site
+# TYPE gmon_goroutine_panics_total counter
+gmon_goroutine_panics_total{pid="100",stack_0="main.main",stack_1="main.startWorker",stack_2="none",stack_3="none",stack_4="none"} 2
+gmon_goroutine_panics_total{pid="100",stack_0="none",stack_1="none",stack_2="none",stack_3="none",stack_4="none"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(metrics.goroutinePanics, strings.NewReader(want)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.goroutinePanicsRecovered))
+	// Only the panic of the unknown goroutine is still in progress.
+	assert.Equal(t, []goroutineKey{{pid: 100, goid: 2}}, h.panics.Keys())
+}
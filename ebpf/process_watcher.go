@@ -0,0 +1,162 @@
+package ebpf
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf/ringbuf"
+	"github.com/keisku/gmon/bininfo"
+)
+
+// loaderDelay is the time to wait for the dynamic loader to map the shared objects of a process that has just exec'd.
+// A Go shared object loaded by a non-Go executable is not mapped yet at sched_process_exec.
+var loaderDelay = 100 * time.Millisecond
+
+// processWatcher detaches the eBPF programs from processes that exit.
+// In the daemon mode, it also attaches the eBPF programs to Go processes that exec.
+// If child processes are followed, it attaches the eBPF programs to Go processes that the targets spawn.
+type processWatcher struct {
+	attacher *attacher
+	reporter *reporter
+	reader   *ringbuf.Reader
+	daemon   bool
+	// inventory is called with the targets attached by the watcher.
+	inventory func(Target)
+	// followed holds the parent pids of the targets and their descendants, keyed by pid.
+	// The parent pid of the targets is 0. It is nil if child processes are not followed.
+	followed map[uint32]uint32
+
+	// mu serializes the events and the retries of the lookup of Go shared objects.
+	mu sync.Mutex
+	// retries are the pending lookups of Go shared objects keyed by pid.
+	// A retry is canceled when the process exits or execs again.
+	retries map[int]*time.Timer
+}
+
+func newProcessWatcher(attacher *attacher, reporter *reporter, reader *ringbuf.Reader, config Config, inventory func(Target)) *processWatcher {
+	w := &processWatcher{
+		attacher:  attacher,
+		reporter:  reporter,
+		reader:    reader,
+		daemon:    config.daemon,
+		inventory: inventory,
+		retries:   make(map[int]*time.Timer),
+	}
+	if config.followChildren {
+		w.followed = make(map[uint32]uint32, len(config.targets))
+		for _, target := range config.targets {
+			w.followed[uint32(target.pid)] = 0
+		}
+	}
+	return w
+}
+
+func (w *processWatcher) run(ctx context.Context) {
+	readEvents(w.reader, "process", func(event bpfProcessEvent) {
+		w.handle(event)
+	})
+}
+
+func (w *processWatcher) handle(event bpfProcessEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch event.Type {
+	case bpfProcessEventTypePROCESS_EXIT:
+		w.cancelRetry(int(event.Pid))
+		w.attacher.detach(int(event.Pid))
+		w.reporter.exitProcess(event.Pid)
+		delete(w.followed, event.Pid)
+	case bpfProcessEventTypePROCESS_FORK:
+		// Children that have not exec'd yet run the same executable as the parent, so only the pid is recorded.
+		// Non-Go children are also recorded since they may exec Go executables, e.g. sh -c.
+		if _, ok := w.followed[event.Ppid]; ok {
+			w.followed[event.Pid] = event.Ppid
+		}
+	case bpfProcessEventTypePROCESS_EXEC:
+		if w.daemon {
+			w.attach(int(event.Pid), 0)
+			return
+		}
+		ppid, ok := w.followed[event.Pid]
+		if !ok {
+			// The fork may have been missed, e.g. when the parent has just been followed.
+			if _, ok := w.followed[event.Ppid]; !ok {
+				return
+			}
+			ppid = event.Ppid
+			w.followed[event.Pid] = ppid
+		}
+		w.attach(int(event.Pid), ppid)
+	}
+}
+
+// attach attaches the eBPF programs to the process if it runs a Go executable.
+// If ppid is not 0, the goroutines of the process are tagged with it.
+func (w *processWatcher) attach(pid int, ppid uint32) {
+	if pid == os.Getpid() {
+		return
+	}
+	// The process may have run another Go executable before exec.
+	w.cancelRetry(pid)
+	w.attacher.detach(pid)
+	w.reporter.forgetProcess(uint32(pid))
+	w.reporter.clearExit(uint32(pid))
+	target, err := ResolveTarget("", pid)
+	if errors.Is(err, bininfo.ErrNoGoRuntime) {
+		// Look up a Go shared object again after the dynamic loader runs.
+		// Shared objects loaded later by dlopen are not found.
+		var retry *time.Timer
+		retry = time.AfterFunc(loaderDelay, func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if w.retries[pid] != retry {
+				// The process has exited or exec'd again in the meantime.
+				return
+			}
+			delete(w.retries, pid)
+			target, err := ResolveTarget("", pid)
+			if err != nil {
+				slog.Debug("skip the process", slog.Int("pid", pid), slog.Any("error", err))
+				return
+			}
+			w.monitor(target, ppid)
+		})
+		w.retries[pid] = retry
+		return
+	}
+	if err != nil {
+		slog.Debug("skip the process", slog.Int("pid", pid), slog.Any("error", err))
+		return
+	}
+	w.monitor(target, ppid)
+}
+
+// cancelRetry cancels the pending lookup of a Go shared object of the process.
+func (w *processWatcher) cancelRetry(pid int) {
+	if retry, ok := w.retries[pid]; ok {
+		retry.Stop()
+		delete(w.retries, pid)
+	}
+}
+
+// monitor attaches the eBPF programs to the target of a process that the watcher found.
+func (w *processWatcher) monitor(target Target, ppid uint32) {
+	pid := target.pid
+	if ppid != 0 {
+		w.reporter.setParent(uint32(pid), ppid)
+	}
+	if err := w.attacher.attach(target); err != nil {
+		slog.Warn("Failed to monitor the process", slog.Int("pid", pid), slog.Any("error", err))
+		return
+	}
+	w.inventory(target)
+	if ppid != 0 {
+		slog.Info("monitor the child process", slog.Int("pid", pid), slog.Uint64("ppid", uint64(ppid)), slog.String("target", target.String()))
+		return
+	}
+	slog.Info("monitor the process", slog.Int("pid", pid), slog.String("target", target.String()))
+}
@@ -0,0 +1,104 @@
+package ebpf
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_processWatcher_handle(t *testing.T) {
+	// The pids do not exist, so that no process is attached.
+	const (
+		target     = 1 << 30
+		child      = target + 1
+		grandchild = target + 2
+		other      = target + 3
+	)
+	tests := []struct {
+		name   string
+		events []bpfProcessEvent
+		want   map[uint32]uint32
+	}{
+		{
+			name: "fork of the target",
+			events: []bpfProcessEvent{
+				{Pid: child, Ppid: target, Type: bpfProcessEventTypePROCESS_FORK},
+				{Pid: child, Ppid: target, Type: bpfProcessEventTypePROCESS_EXEC},
+			},
+			want: map[uint32]uint32{target: 0, child: target},
+		},
+		{
+			name: "fork of a child",
+			events: []bpfProcessEvent{
+				{Pid: child, Ppid: target, Type: bpfProcessEventTypePROCESS_FORK},
+				{Pid: grandchild, Ppid: child, Type: bpfProcessEventTypePROCESS_FORK},
+			},
+			want: map[uint32]uint32{target: 0, child: target, grandchild: child},
+		},
+		{
+			name: "exec without fork",
+			events: []bpfProcessEvent{
+				{Pid: child, Ppid: target, Type: bpfProcessEventTypePROCESS_EXEC},
+			},
+			want: map[uint32]uint32{target: 0, child: target},
+		},
+		{
+			name: "other processes",
+			events: []bpfProcessEvent{
+				{Pid: other, Ppid: 1, Type: bpfProcessEventTypePROCESS_FORK},
+				{Pid: other, Ppid: 1, Type: bpfProcessEventTypePROCESS_EXEC},
+			},
+			want: map[uint32]uint32{target: 0},
+		},
+		{
+			name: "exit",
+			events: []bpfProcessEvent{
+				{Pid: child, Ppid: target, Type: bpfProcessEventTypePROCESS_FORK},
+				{Pid: child, Ppid: target, Type: bpfProcessEventTypePROCESS_EXIT},
+				{Pid: target, Ppid: 1, Type: bpfProcessEventTypePROCESS_EXIT},
+			},
+			want: map[uint32]uint32{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{
+				targets:        []Target{{pid: target}},
+				followChildren: true,
+			}
+			r := &reporter{metrics: newTestMetrics(t, config)}
+			w := newProcessWatcher(newAttacher(config), r, nil, config, func(Target) {})
+			for _, event := range tt.events {
+				w.handle(event)
+			}
+			assert.Equal(t, tt.want, w.followed)
+		})
+	}
+}
+
+func Test_processWatcher_cancelRetry(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep is not found")
+	}
+	cmd := exec.Command(sleep, "60")
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	pid := uint32(cmd.Process.Pid)
+	config := Config{daemon: true}
+	r := &reporter{metrics: newTestMetrics(t, config)}
+	w := newProcessWatcher(newAttacher(config), r, nil, config, func(Target) {})
+
+	// A non-Go process is looked up again after the dynamic loader runs, unless it exits before.
+	w.handle(bpfProcessEvent{Pid: pid, Type: bpfProcessEventTypePROCESS_EXEC})
+	require.Contains(t, w.retries, int(pid))
+	retry := w.retries[int(pid)]
+	w.handle(bpfProcessEvent{Pid: pid, Type: bpfProcessEventTypePROCESS_EXIT})
+	assert.Empty(t, w.retries)
+	assert.False(t, retry.Stop(), "the retry has been stopped")
+}
@@ -0,0 +1,75 @@
+package ebpf
+
+import (
+	"context"
+	"log/slog"
+	"runtime/trace"
+	"time"
+
+	"github.com/keisku/gmon/bininfo"
+)
+
+// reconcileGracePeriod excludes the goroutines observed right before the scan of runtime.allgs,
+// since they may have been created after the scan.
+var reconcileGracePeriod = 10 * time.Second
+
+// reconciler periodically evicts the goroutines that are not live in the processes anymore.
+// They remain if the exit events are lost due to the full ring buffer or missed uprobe hits.
+type reconciler struct {
+	reporter *reporter
+	attacher *attacher
+	interval time.Duration
+}
+
+func newReconciler(reporter *reporter, attacher *attacher, config Config) *reconciler {
+	return &reconciler{
+		reporter: reporter,
+		attacher: attacher,
+		interval: config.reconcileInterval,
+	}
+}
+
+func (r *reconciler) run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	for {
+		select {
+		case <-ctx.Done():
+			ticker.Stop()
+			return
+		case <-ticker.C:
+			_, task := trace.NewTask(ctx, "reconciler.reconcile")
+			r.reporter.processes.Range(func(key, _ any) bool {
+				r.reconcile(key.(uint32))
+				return true
+			})
+			task.End()
+		}
+	}
+}
+
+// reconcile evicts the goroutines of the process that are not in runtime.allgs.
+// A goroutine is evicted if it has exited, or if its g has been reused by another goroutine with a new goid.
+func (r *reconciler) reconcile(pid uint32) {
+	object, path, ok := r.attacher.goObject(int(pid))
+	if !ok {
+		return
+	}
+	before := time.Now().Add(-reconcileGracePeriod)
+	goroutines, err := bininfo.ReadGoroutines(int(pid), path, object.layout)
+	if err != nil {
+		// The process may have exited.
+		slog.Debug("failed to read the goroutines", slog.Uint64("pid", uint64(pid)), slog.Any("error", err))
+		return
+	}
+	if len(goroutines) == 0 {
+		// The runtime has not been initialized yet.
+		return
+	}
+	live := make(map[int64]bool, len(goroutines))
+	for _, g := range goroutines {
+		live[g.Id] = true
+	}
+	if evicted := r.reporter.evictGoroutines(pid, live, before); evicted > 0 {
+		slog.Info("evicted goroutines that are not live", slog.Uint64("pid", uint64(pid)), slog.Int("goroutines", evicted))
+	}
+}
@@ -6,84 +6,82 @@ import (
 	"log/slog"
 	"runtime/trace"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/go-delve/delve/pkg/proc"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
-)
-
-var (
-	namespace      = "gmon"
-	stackLabelKeys = []string{"stack_0", "stack_1", "stack_2", "stack_3", "stack_4"} // 0 is the top
-	goroutineExit  = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Namespace: namespace,
-			Name:      "goroutine_exit",
-			Help:      "The number of goroutines that have been exited",
-		},
-		stackLabelKeys,
-	)
-	goroutineCreation = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Namespace: namespace,
-			Name:      "goroutine_creation",
-			Help:      "The number of goroutines that have been creaated",
-		},
-		stackLabelKeys,
-	)
-	goroutineUptime = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Namespace: namespace,
-			Name:      "goroutine_uptime",
-			Help:      "Uptime of goroutines in seconds",
-			Buckets:   []float64{1, 3, 5, 10, 30, 60, 120, 180},
-		},
-		stackLabelKeys,
-	)
 )
 
 type goroutine struct {
-	Id         int64
+	Id       int64
+	ParentId int64 // 0 if unknown
+	Pid      uint32
+	Ppid     uint32 // 0 unless the process is a followed child process
+	// ObservedAt is the wall clock time when the kernel observed the event, converted from Ktime.
 	ObservedAt time.Time
-	Stack      []*proc.Function
-	Exit       bool
+	// Ktime is the CLOCK_MONOTONIC nanoseconds when the kernel observed the event, the clock of bpf_ktime_get_ns.
+	// It is not affected by the delay until gmon processes the event.
+	Ktime         uint64
+	Stack         []location
+	CreatedBy     location // the go statement that created the goroutine
+	StartFunction location // the function that the goroutine runs
+	Exit          bool
+	// Preexisting is true if the goroutine existed before gmon attached to the process.
+	// ObservedAt is the time of the attach, and the stack is only the go statement since the creation stack is unknown.
+	Preexisting bool
+	// channelBlocked is the total nanoseconds that the goroutine was blocked on channels.
+	// It is shared by the copies of the goroutine, and nil until the goroutine is stored.
+	channelBlocked *atomic.Int64
+	// schedLatency is the time that the goroutine was runnable until it got a P.
+	// It is shared by the copies of the goroutine, and nil until the goroutine is stored.
+	schedLatency *schedLatency
+}
+
+// location is a symbolized program counter.
+// Locations of inlined calls share the PC with the caller.
+type location struct {
+	PC       uint64
+	Function string
+	File     string
+	Line     int
+	Inlined  bool
+}
+
+func (l location) String() string {
+	if l.File == "" {
+		return l.Function
+	}
+	return fmt.Sprintf("%s %s:%d", l.Function, l.File, l.Line)
+}
+
+// goroutineKey identifies a goroutine across processes since goroutine IDs are only unique within a process.
+type goroutineKey struct {
+	pid  uint32
+	goid int64
 }
 
+func (g goroutine) key() goroutineKey {
+	return goroutineKey{pid: g.Pid, goid: g.Id}
+}
+
+// exitedProcessTTL is how long the events of an exited process are dropped,
+// since they can arrive after the exit through another ring buffer.
+var exitedProcessTTL = time.Minute
+
 type reporter struct {
 	goroutineQueue <-chan goroutine
 	goroutineMap   sync.Map
+	processes      sync.Map // pids of the stored goroutines
+	parents        sync.Map // parent pids keyed by the pids of followed child processes
+	exited         sync.Map // exit times keyed by the pids of exited processes, deleted after exitedProcessTTL
+	metrics        *metrics
+	// retainedPids are the processes whose metrics remain after they exit, e.g. to be summarized.
+	retainedPids map[uint32]bool
 }
 
-var reportInterval = 500 * time.Millisecond
-
 func (r *reporter) run(ctx context.Context) {
-	go r.reportUptime(ctx)
 	go r.subscribe(ctx)
 	<-ctx.Done()
 }
 
-func (r *reporter) reportUptime(ctx context.Context) {
-	ticker := time.NewTicker(reportInterval)
-	for {
-		select {
-		case <-ctx.Done():
-			ticker.Stop()
-			return
-		case <-ticker.C:
-			ctx, task := trace.NewTask(ctx, "reporter.report_goroutine_uptime")
-			trace.WithRegion(ctx, "reporter.report_goroutine_uptime.iterate_goroutine_map", func() {
-				r.goroutineMap.Range(func(_, value any) bool {
-					g := value.(goroutine)
-					goroutineUptime.With(stackLabels(g.Stack)).Observe(time.Since(g.ObservedAt).Seconds())
-					return true
-				})
-			})
-			task.End()
-		}
-	}
-}
-
 func (r *reporter) subscribe(ctx context.Context) {
 	for g := range r.goroutineQueue {
 		ctx, task := trace.NewTask(ctx, "reporter.store_goroutine")
@@ -93,7 +91,15 @@ func (r *reporter) subscribe(ctx context.Context) {
 }
 
 func (r *reporter) storeGoroutine(ctx context.Context, g goroutine) {
-	v, loaded := r.goroutineMap.Load(g.Id)
+	if _, ok := r.exited.Load(g.Pid); ok {
+		// The goroutines of an exited process must not recreate its series.
+		return
+	}
+	v, loaded := r.goroutineMap.Load(g.key())
+	if loaded && !g.Exit {
+		// A goroutine created right after the attach can be found by both the uprobe and the scan of runtime.allgs.
+		return
+	}
 	if loaded {
 		_, task := trace.NewTask(ctx, "reporter.store_goroutine_exit")
 		oldg, ok := v.(goroutine)
@@ -101,9 +107,19 @@ func (r *reporter) storeGoroutine(ctx context.Context, g goroutine) {
 			slog.Error("goroutineMap has unexpected value", slog.Any("value", v))
 			return
 		}
-		goroutineExit.With(stackLabels(oldg.Stack)).Inc()
-		goroutineUptime.With(stackLabels(oldg.Stack)).Observe(time.Since(oldg.ObservedAt).Seconds())
-		r.goroutineMap.Delete(oldg.Id)
+		if _, ok := r.goroutineMap.LoadAndDelete(oldg.key()); !ok {
+			// The goroutine has been evicted by the reconciler.
+			task.End()
+			return
+		}
+		labels := r.metrics.goroutineLabels(oldg)
+		r.metrics.goroutineExit.With(labels).Inc()
+		r.metrics.goroutineLive.With(labels).Dec()
+		r.metrics.processGoroutines.With(processLabels(oldg)).Dec()
+		if !oldg.Preexisting {
+			// The lifetime of a pre-existing goroutine is unknown.
+			r.metrics.goroutineLifetime.With(labels).Observe(lifetime(oldg, g).Seconds())
+		}
 		task.End()
 		return
 	}
@@ -112,44 +128,137 @@ func (r *reporter) storeGoroutine(ctx context.Context, g goroutine) {
 		return
 	}
 	_, task := trace.NewTask(ctx, "reporter.store_goroutine_creation")
-	slog.Info("goroutine is created", slog.Int64("goroutine_id", g.Id), stackLogAttr(g.Stack))
-	goroutineCreation.With(stackLabels(g.Stack)).Inc()
-	r.goroutineMap.Store(g.Id, g)
+	if ppid, ok := r.parents.Load(g.Pid); ok {
+		g.Ppid = ppid.(uint32)
+	}
+	if g.Preexisting {
+		slog.Debug(
+			"goroutine existed before the attach",
+			slog.Uint64("pid", uint64(g.Pid)),
+			slog.Int64("goroutine_id", g.Id),
+			slog.String("created_by", g.CreatedBy.String()),
+			slog.String("start_function", g.StartFunction.String()),
+		)
+	} else {
+		slog.Info(
+			"goroutine is created",
+			slog.Uint64("pid", uint64(g.Pid)),
+			slog.Int64("goroutine_id", g.Id),
+			slog.Int64("parent_goroutine_id", g.ParentId),
+			slog.String("created_by", g.CreatedBy.String()),
+			slog.String("start_function", g.StartFunction.String()),
+			slog.Time("observed_at", g.ObservedAt),
+			slog.Uint64("observed_at_monotonic_ns", g.Ktime),
+			stackLogAttr(g.Stack),
+		)
+	}
+	labels := r.metrics.goroutineLabels(g)
+	if g.Preexisting {
+		r.metrics.goroutinePreexisting.With(labels).Inc()
+	} else {
+		r.metrics.goroutineCreation.With(labels).Inc()
+	}
+	r.metrics.goroutineLive.With(labels).Inc()
+	r.metrics.processGoroutines.With(processLabels(g)).Inc()
+	g.channelBlocked = new(atomic.Int64)
+	g.schedLatency = new(schedLatency)
+	r.goroutineMap.Store(g.key(), g)
+	r.processes.Store(g.Pid, struct{}{})
 	task.End()
 }
 
-// LogAttr returns a slog.Attr that can be used to log the stack.
-func stackLogAttr(stack []*proc.Function) slog.Attr {
-	attrs := make([]any, len(stack))
-	for i, f := range stack {
-		if f == nil {
-			panic("stack must not have nil function")
-		}
-		attrs[i] = slog.String(fmt.Sprintf("%d", i), f.Name)
+// lifetime returns the duration from the creation to the exit of the goroutine measured by the kernel clock.
+// It falls back to the wall clock times if either event lacks the kernel time.
+func lifetime(created, exited goroutine) time.Duration {
+	if created.Ktime != 0 && exited.Ktime >= created.Ktime {
+		return time.Duration(exited.Ktime - created.Ktime)
 	}
-	return slog.Group("stack", attrs...)
+	return exited.ObservedAt.Sub(created.ObservedAt)
 }
 
-// stackLabels generates a set of Prometheus labels for the top functions in the stack.
-// If the stack has fewer than expected functions, it fills the remaining labels with "none".
-func stackLabels(stack []*proc.Function) prometheus.Labels {
-	labels := prometheus.Labels{}
-
-	// Ensure to only process the top 5 elements, or the stack length if shorter.
-	topN := len(stack)
-	if topN > len(stackLabelKeys) {
-		topN = len(stackLabelKeys)
+// goroutine returns the live goroutine.
+func (r *reporter) goroutine(key goroutineKey) (goroutine, bool) {
+	v, ok := r.goroutineMap.Load(key)
+	if !ok {
+		return goroutine{}, false
 	}
+	return v.(goroutine), true
+}
+
+// setParent tags the goroutines of the followed child process with the parent pid.
+func (r *reporter) setParent(pid, ppid uint32) {
+	r.parents.Store(pid, ppid)
+}
+
+// exitProcess forgets the exited process and drops its events that arrive later.
+func (r *reporter) exitProcess(pid uint32) {
+	exitedAt := time.Now()
+	r.exited.Store(pid, exitedAt)
+	time.AfterFunc(exitedProcessTTL, func() {
+		// The pid may have exited again since it was reused.
+		r.exited.CompareAndDelete(pid, exitedAt)
+	})
+	r.forgetProcess(pid)
+}
 
-	for i := 0; i < len(stackLabelKeys); i++ {
-		labelKey := fmt.Sprintf("stack_%d", i)
-		if i < topN {
-			// Stack is reversed, so we start from the end of the slice.
-			labels[labelKey] = stack[len(stack)-1-i].Name
-		} else {
-			labels[labelKey] = "none"
+// clearExit accepts the events of the pid again since it is reused by a new process.
+func (r *reporter) clearExit(pid uint32) {
+	r.exited.Delete(pid)
+}
+
+// forgetProcess deletes the goroutines and the metrics of the process that has exited.
+// They are not counted as exited goroutines since runtime.goexit1 is not called for them.
+func (r *reporter) forgetProcess(pid uint32) {
+	r.parents.Delete(pid)
+	if _, ok := r.processes.LoadAndDelete(pid); !ok {
+		return
+	}
+	r.goroutineMap.Range(func(key, value any) bool {
+		g := value.(goroutine)
+		if g.Pid != pid {
+			return true
 		}
+		r.metrics.goroutineLive.With(r.metrics.goroutineLabels(g)).Dec()
+		r.goroutineMap.Delete(key)
+		return true
+	})
+	if r.retainedPids[pid] {
+		r.metrics.processGoroutines.Delete(processLabels(goroutine{Pid: pid}))
+	} else {
+		r.metrics.deleteProcess(pid)
 	}
+	slog.Debug("forget the goroutines of the exited process", slog.Uint64("pid", uint64(pid)))
+}
 
-	return labels
+// evictGoroutines deletes the goroutines of the process observed before the given time that are not live in the process.
+// It returns the number of the evicted goroutines.
+func (r *reporter) evictGoroutines(pid uint32, live map[int64]bool, before time.Time) int {
+	var evicted int
+	r.goroutineMap.Range(func(key, value any) bool {
+		g := value.(goroutine)
+		if g.Pid != pid || live[g.Id] || !g.ObservedAt.Before(before) {
+			return true
+		}
+		if _, ok := r.goroutineMap.LoadAndDelete(key); !ok {
+			// The goroutine has just exited.
+			return true
+		}
+		labels := r.metrics.goroutineLabels(g)
+		r.metrics.goroutineReconciled.With(labels).Inc()
+		r.metrics.goroutineLive.With(labels).Dec()
+		r.metrics.processGoroutines.With(processLabels(g)).Dec()
+		slog.Debug("evict the goroutine that is not live", slog.Uint64("pid", uint64(pid)), slog.Int64("goroutine_id", g.Id))
+		evicted++
+		return true
+	})
+	return evicted
+}
+
+// LogAttr returns a slog.Attr that can be used to log the stack.
+func stackLogAttr(stack []location) slog.Attr {
+	attrs := make([]any, len(stack))
+	for i, l := range stack {
+		attrs[i] = slog.String(fmt.Sprintf("%d", i), l.String())
+	}
+	return slog.Group("stack", attrs...)
 }
@@ -1,86 +1,185 @@
 package ebpf
 
 import (
+	"context"
 	"testing"
+	"time"
 
-	"github.com/go-delve/delve/pkg/proc"
-	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
-func Test_stackLabels(t *testing.T) {
-	type args struct {
-		stack []*proc.Function
+func Test_reporter_forgetProcess(t *testing.T) {
+	r := &reporter{
+		metrics: newTestMetrics(t, Config{}),
 	}
+	now := time.Now()
+	for _, g := range []goroutine{
+		{Id: 1, Pid: 100, ObservedAt: now},
+		{Id: 2, Pid: 100, ObservedAt: now},
+		{Id: 1, Pid: 200, ObservedAt: now},
+	} {
+		r.storeGoroutine(context.Background(), g)
+	}
+
+	r.forgetProcess(100)
+
+	gs := r.liveGoroutines()
+	assert.Len(t, gs, 1)
+	assert.Equal(t, uint32(200), gs[0].Pid)
+	assert.Equal(t, 1, testutil.CollectAndCount(r.metrics.processGoroutines))
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.metrics.processGoroutines.With(processLabels(goroutine{Pid: 200}))))
+
+	// The series of the process are deleted from all metrics.
+	assert.Equal(t, 1, testutil.CollectAndCount(r.metrics.goroutineCreation))
+	assert.Equal(t, 1, testutil.CollectAndCount(r.metrics.goroutineLive))
+
+	// Forgetting an unknown process is a no-op.
+	r.forgetProcess(300)
+	assert.Len(t, r.liveGoroutines(), 1)
+}
+
+func Test_reporter_forgetProcess_retained(t *testing.T) {
+	r := &reporter{
+		metrics:      newTestMetrics(t, Config{}),
+		retainedPids: map[uint32]bool{100: true},
+	}
+	now := time.Now()
+	for _, g := range []goroutine{
+		{Id: 1, Pid: 100, ObservedAt: now},
+		{Id: 2, Pid: 100, ObservedAt: now},
+		{Id: 1, Pid: 100, ObservedAt: now, Exit: true},
+	} {
+		r.storeGoroutine(context.Background(), g)
+	}
+
+	r.forgetProcess(100)
+
+	assert.Empty(t, r.liveGoroutines())
+	assert.Equal(t, 0, testutil.CollectAndCount(r.metrics.processGoroutines))
+	// The counters remain to be summarized.
+	labels := r.metrics.goroutineLabels(goroutine{Pid: 100})
+	assert.Equal(t, float64(2), testutil.ToFloat64(r.metrics.goroutineCreation.With(labels)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.metrics.goroutineExit.With(labels)))
+}
+
+func Test_reporter_storeGoroutine_preexisting(t *testing.T) {
+	r := &reporter{
+		metrics: newTestMetrics(t, Config{}),
+	}
+	now := time.Now()
+	for _, g := range []goroutine{
+		{Id: 1, Pid: 100, ObservedAt: now, Preexisting: true},
+		{Id: 2, Pid: 100, ObservedAt: now, Preexisting: true},
+		// The creation is also found by the scan.
+		{Id: 3, Pid: 100, ObservedAt: now},
+		{Id: 3, Pid: 100, ObservedAt: now, Preexisting: true},
+		// The exit of a pre-existing goroutine.
+		{Id: 1, Pid: 100, ObservedAt: now, Exit: true},
+	} {
+		r.storeGoroutine(context.Background(), g)
+	}
+
+	gs := r.liveGoroutines()
+	assert.Len(t, gs, 2)
+	assert.True(t, gs[0].Preexisting)
+	assert.False(t, gs[1].Preexisting)
+	labels := r.metrics.goroutineLabels(goroutine{Pid: 100})
+	assert.Equal(t, float64(2), testutil.ToFloat64(r.metrics.goroutinePreexisting.With(labels)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.metrics.goroutineCreation.With(labels)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.metrics.goroutineExit.With(labels)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(r.metrics.processGoroutines.With(processLabels(goroutine{Pid: 100}))))
+	// The lifetime of the pre-existing goroutine is unknown.
+	assert.Equal(t, 0, testutil.CollectAndCount(r.metrics.goroutineLifetime))
+}
+
+func Test_reporter_evictGoroutines(t *testing.T) {
+	r := &reporter{
+		metrics: newTestMetrics(t, Config{}),
+	}
+	now := time.Now()
+	for _, g := range []goroutine{
+		{Id: 1, Pid: 100, ObservedAt: now.Add(-time.Minute)},
+		// The exit event has been lost.
+		{Id: 2, Pid: 100, ObservedAt: now.Add(-time.Minute)},
+		// The goroutine may have been created after the scan.
+		{Id: 3, Pid: 100, ObservedAt: now},
+		{Id: 2, Pid: 200, ObservedAt: now.Add(-time.Minute)},
+	} {
+		r.storeGoroutine(context.Background(), g)
+	}
+
+	assert.Equal(t, 1, r.evictGoroutines(100, map[int64]bool{1: true}, now.Add(-time.Second)))
+
+	gs := r.liveGoroutines()
+	assert.Len(t, gs, 3)
+	for _, g := range gs {
+		assert.False(t, g.Pid == 100 && g.Id == 2)
+	}
+	labels := r.metrics.goroutineLabels(goroutine{Pid: 100})
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.metrics.goroutineReconciled.With(labels)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(r.metrics.goroutineLive.With(labels)))
+
+	// The exit event of the evicted goroutine is ignored.
+	r.storeGoroutine(context.Background(), goroutine{Id: 2, Pid: 100, Exit: true})
+	assert.Equal(t, float64(0), testutil.ToFloat64(r.metrics.goroutineExit.With(labels)))
+}
+
+func Test_lifetime(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 	tests := []struct {
-		name string
-		args args
-		want prometheus.Labels
+		name    string
+		created goroutine
+		exited  goroutine
+		want    time.Duration
 	}{
 		{
-			name: "stack length is 5",
-			args: args{
-				stack: []*proc.Function{
-					{Name: "func1"},
-					{Name: "func2"},
-					{Name: "func3"},
-					{Name: "func4"},
-					{Name: "func5"},
-				},
-			},
-			want: prometheus.Labels{
-				"stack_0": "func5",
-				"stack_1": "func4",
-				"stack_2": "func3",
-				"stack_3": "func2",
-				"stack_4": "func1",
-			},
+			name:    "kernel clock",
+			created: goroutine{ObservedAt: createdAt, Ktime: uint64(time.Second)},
+			// The wall clock times are skewed by the delay to process the events.
+			exited: goroutine{ObservedAt: createdAt.Add(5 * time.Second), Ktime: uint64(3 * time.Second)},
+			want:   2 * time.Second,
 		},
 		{
-			name: "stack length is 3",
-			args: args{
-				stack: []*proc.Function{
-					{Name: "func1"},
-					{Name: "func2"},
-					{Name: "func3"},
-				},
-			},
-			want: prometheus.Labels{
-				"stack_0": "func3",
-				"stack_1": "func2",
-				"stack_2": "func1",
-				"stack_3": "none",
-				"stack_4": "none",
-			},
-		},
-		{
-			name: "stack length is 10",
-			args: args{
-				stack: []*proc.Function{
-					{Name: "func1"},
-					{Name: "func2"},
-					{Name: "func3"},
-					{Name: "func4"},
-					{Name: "func5"},
-					{Name: "func6"},
-					{Name: "func7"},
-					{Name: "func8"},
-					{Name: "func9"},
-					{Name: "func10"},
-				},
-			},
-			want: prometheus.Labels{
-				"stack_0": "func10",
-				"stack_1": "func9",
-				"stack_2": "func8",
-				"stack_3": "func7",
-				"stack_4": "func6",
-			},
+			name:    "pre-existing goroutine without the kernel clock",
+			created: goroutine{ObservedAt: createdAt},
+			exited:  goroutine{ObservedAt: createdAt.Add(5 * time.Second), Ktime: uint64(3 * time.Second)},
+			want:    5 * time.Second,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.Equal(t, tt.want, stackLabels(tt.args.stack))
+			assert.Equal(t, tt.want, lifetime(tt.created, tt.exited))
 		})
 	}
 }
+
+func Test_reporter_exitProcess(t *testing.T) {
+	defer func(ttl time.Duration) { exitedProcessTTL = ttl }(exitedProcessTTL)
+	exitedProcessTTL = 100 * time.Millisecond
+	r := &reporter{
+		metrics: newTestMetrics(t, Config{}),
+	}
+	now := time.Now()
+	r.storeGoroutine(context.Background(), goroutine{Id: 1, Pid: 100, ObservedAt: now})
+
+	r.exitProcess(100)
+
+	// The creation event that arrives after the exit does not recreate the series of the process.
+	r.storeGoroutine(context.Background(), goroutine{Id: 2, Pid: 100, ObservedAt: now})
+	assert.Empty(t, r.liveGoroutines())
+	assert.Equal(t, 0, testutil.CollectAndCount(r.metrics.goroutineCreation))
+	assert.Equal(t, 0, testutil.CollectAndCount(r.metrics.processGoroutines))
+
+	// The events are accepted again after the tombstone expires.
+	assert.Eventually(t, func() bool {
+		r.storeGoroutine(context.Background(), goroutine{Id: 3, Pid: 100, ObservedAt: now})
+		return len(r.liveGoroutines()) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// The pid reused by a new process is accepted immediately.
+	r.exitProcess(100)
+	r.clearExit(100)
+	r.storeGoroutine(context.Background(), goroutine{Id: 4, Pid: 100, ObservedAt: now})
+	assert.Len(t, r.liveGoroutines(), 1)
+}
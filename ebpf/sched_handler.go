@@ -0,0 +1,112 @@
+package ebpf
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/cilium/ebpf/ringbuf"
+)
+
+// schedLatency is the time that a goroutine was runnable until it got a P.
+type schedLatency struct {
+	count atomic.Int64
+	total atomic.Int64 // nanoseconds
+	max   atomic.Int64 // nanoseconds
+}
+
+func (s *schedLatency) observe(latency time.Duration) {
+	s.count.Add(1)
+	s.total.Add(int64(latency))
+	for {
+		m := s.max.Load()
+		if int64(latency) <= m || s.max.CompareAndSwap(m, int64(latency)) {
+			return
+		}
+	}
+}
+
+// schedLatencyView is the JSON representation of schedLatency.
+type schedLatencyView struct {
+	Schedules    int64   `json:"schedules"`
+	TotalSeconds float64 `json:"total_seconds"`
+	MaxSeconds   float64 `json:"max_seconds"`
+}
+
+// newSchedLatencyView returns nil if the goroutine has not been scheduled since it was stored.
+func newSchedLatencyView(s *schedLatency) *schedLatencyView {
+	if s == nil || s.count.Load() == 0 {
+		return nil
+	}
+	return &schedLatencyView{
+		Schedules:    s.count.Load(),
+		TotalSeconds: time.Duration(s.total.Load()).Seconds(),
+		MaxSeconds:   time.Duration(s.max.Load()).Seconds(),
+	}
+}
+
+// schedHandler observes the time that goroutines were runnable until they got a P by the creation site.
+// The latency grows when the runnable goroutines outnumber GOMAXPROCS.
+type schedHandler struct {
+	reader   *ringbuf.Reader
+	reporter *reporter
+	metrics  *metrics
+}
+
+func newSchedHandler(reader *ringbuf.Reader, reporter *reporter, metrics *metrics) *schedHandler {
+	return &schedHandler{
+		reader:   reader,
+		reporter: reporter,
+		metrics:  metrics,
+	}
+}
+
+func (h *schedHandler) run(ctx context.Context) {
+	readEvents(h.reader, "sched", func(event bpfSchedEvent) {
+		h.observe(event)
+	})
+}
+
+func (h *schedHandler) observe(event bpfSchedEvent) {
+	// The creation site of a goroutine that is not stored is unknown.
+	g, ok := h.reporter.goroutine(goroutineKey{pid: event.Pid, goid: event.GoroutineId})
+	if !ok {
+		return
+	}
+	latency := time.Duration(event.LatencyNs)
+	if g.schedLatency != nil {
+		g.schedLatency.observe(latency)
+	}
+	h.metrics.goroutineSchedLatency.With(h.metrics.goroutineLabels(g)).Observe(latency.Seconds())
+}
+
+// slowestScheduled returns the goroutines that waited the longest for a P at once, up to limit.
+// Goroutines that have not been scheduled since they were stored are omitted.
+func slowestScheduled(gs []goroutine, limit int) []goroutine {
+	type scheduledGoroutine struct {
+		g          goroutine
+		max, total int64
+	}
+	// The latencies are loaded once since they keep changing while sorting.
+	var scheduled []scheduledGoroutine
+	for _, g := range gs {
+		if g.schedLatency != nil && g.schedLatency.count.Load() > 0 {
+			scheduled = append(scheduled, scheduledGoroutine{g: g, max: g.schedLatency.max.Load(), total: g.schedLatency.total.Load()})
+		}
+	}
+	sort.SliceStable(scheduled, func(i, j int) bool {
+		if scheduled[i].max != scheduled[j].max {
+			return scheduled[i].max > scheduled[j].max
+		}
+		return scheduled[i].total > scheduled[j].total
+	})
+	if len(scheduled) > limit {
+		scheduled = scheduled[:limit]
+	}
+	slowest := make([]goroutine, len(scheduled))
+	for i := range scheduled {
+		slowest[i] = scheduled[i].g
+	}
+	return slowest
+}
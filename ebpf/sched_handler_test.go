@@ -0,0 +1,115 @@
+package ebpf
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_schedHandler_observe(t *testing.T) {
+	config := Config{schedLatency: true, schedBuckets: []float64{0.001, 0.01}}
+	metrics := newTestMetrics(t, config)
+	r := &reporter{metrics: metrics}
+	r.storeGoroutine(context.Background(), goroutine{
+		Id:         1,
+		Pid:        100,
+		ObservedAt: time.Now(),
+		Stack:      []location{{PC: 0x10, Function: "main.startWorker"}, {PC: 0x20, Function: "main.main"}},
+	})
+	h := newSchedHandler(nil, r, metrics)
+
+	for _, event := range []bpfSchedEvent{
+		{GoroutineId: 1, Pid: 100, LatencyNs: uint64(500 * time.Microsecond)},
+		{GoroutineId: 1, Pid: 100, LatencyNs: uint64(5 * time.Millisecond)},
+		{GoroutineId: 1, Pid: 100, LatencyNs: uint64(2 * time.Millisecond)},
+		// The goroutine is unknown.
+		{GoroutineId: 2, Pid: 100, LatencyNs: uint64(time.Second)},
+	} {
+		h.observe(event)
+	}
+
+	want := `
+# HELP gmon_goroutine_sched_latency_seconds Time in seconds that goroutines were runnable until they got a P
+# TYPE gmon_goroutine_sched_latency_seconds histogram
+gmon_goroutine_sched_latency_seconds_bucket{pid="100",stack_0="main.main",stack_1="main.startWorker",stack_2="none",stack_3="none",stack_4="none",le="0.001"} 1
+gmon_goroutine_sched_latency_seconds_bucket{pid="100",stack_0="main.main",stack_1="main.startWorker",stack_2="none",stack_3="none",stack_4="none",le="0.01"} 3
+gmon_goroutine_sched_latency_seconds_bucket{pid="100",stack_0="main.main",stack_1="main.startWorker",stack_2="none",stack_3="none",stack_4="none",le="+Inf"} 3
+gmon_goroutine_sched_latency_seconds_sum{pid="100",stack_0="main.main",stack_1="main.startWorker",stack_2="none",stack_3="none",stack_4="none"} 0.0075
+gmon_goroutine_sched_latency_seconds_count{pid="100",stack_0="main.main",stack_1="main.startWorker",stack_2="none",stack_3="none",stack_4="none"} 3
+`
+	assert.NoError(t, testutil.CollectAndCompare(metrics.goroutineSchedLatency, strings.NewReader(want)))
+	g, ok := r.goroutine(goroutineKey{pid: 100, goid: 1})
+	require.True(t, ok)
+	assert.Equal(t, &schedLatencyView{Schedules: 3, TotalSeconds: 0.0075, MaxSeconds: 0.005}, newSchedLatencyView(g.schedLatency))
+}
+
+func Test_slowestScheduled(t *testing.T) {
+	newGoroutine := func(id int64, latencies ...time.Duration) goroutine {
+		g := goroutine{Id: id, Pid: 100, schedLatency: new(schedLatency)}
+		for _, l := range latencies {
+			g.schedLatency.observe(l)
+		}
+		return g
+	}
+	gs := []goroutine{
+		newGoroutine(1, time.Millisecond),
+		newGoroutine(2, 3*time.Millisecond, time.Millisecond),
+		// Not scheduled since it was stored.
+		newGoroutine(3),
+		newGoroutine(4, 3*time.Millisecond, 2*time.Millisecond),
+		// Stored before -sched-latency was enabled.
+		{Id: 5, Pid: 100},
+	}
+	tests := []struct {
+		name    string
+		limit   int
+		wantIds []int64
+	}{
+		{name: "all", limit: 10, wantIds: []int64{4, 2, 1}},
+		{name: "limited", limit: 2, wantIds: []int64{4, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := slowestScheduled(gs, tt.limit)
+			ids := make([]int64, len(got))
+			for i := range got {
+				ids[i] = got[i].Id
+			}
+			assert.Equal(t, tt.wantIds, ids)
+		})
+	}
+}
+
+func Test_reporter_serveSlowestScheduled(t *testing.T) {
+	r := &reporter{metrics: newTestMetrics(t, Config{})}
+	r.storeGoroutine(context.Background(), goroutine{Id: 1, Pid: 100, ObservedAt: time.Now()})
+	g, ok := r.goroutine(goroutineKey{pid: 100, goid: 1})
+	require.True(t, ok)
+	g.schedLatency.observe(time.Millisecond)
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{name: "default limit", query: "", wantStatus: http.StatusOK},
+		{name: "limit", query: "?limit=5", wantStatus: http.StatusOK},
+		{name: "invalid limit", query: "?limit=abc", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.serveSlowestScheduled(rec, httptest.NewRequest(http.MethodGet, "/goroutines/sched"+tt.query, nil))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Contains(t, rec.Body.String(), `"sched_latency":{"schedules":1,"total_seconds":0.001,"max_seconds":0.001}`)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package ebpf
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+)
+
+// maxCachedStacks bounds the symbolized stacks, and so the stack ids kept in stack_addresses.
+const maxCachedStacks = 1024
+
+// stackKey identifies a stack of a process. Processes share the stack id of the same addresses,
+// but the addresses are symbolized with the binaries of each process.
+type stackKey struct {
+	pid uint32
+	id  int32
+}
+
+// stackCache caches the symbolized stacks of stack_addresses and is the only owner that deletes them.
+// bpf_get_stackid reuses a deleted stack id for another stack, so a stack id is deleted only when
+// no process has the stack in the cache and no goroutine is looking it up.
+type stackCache struct {
+	load    func(ctx context.Context, pid uint32, id int32) ([]location, error)
+	release func(id int32) error
+
+	mu     sync.Mutex
+	stacks *simplelru.LRU[stackKey, []location]
+	refs   map[int32]int
+}
+
+func newStackCache(size int, load func(ctx context.Context, pid uint32, id int32) ([]location, error), release func(id int32) error) *stackCache {
+	c := &stackCache{
+		load:    load,
+		release: release,
+		refs:    make(map[int32]int),
+	}
+	stacks, err := simplelru.NewLRU(size, func(key stackKey, _ []location) {
+		// The eviction runs in Add with the lock held.
+		c.unref(key.id)
+	})
+	if err != nil {
+		// The size is a positive constant.
+		panic(err)
+	}
+	c.stacks = stacks
+	return c
+}
+
+// get returns the symbolized stack of the process, and loads it if it is not cached.
+func (c *stackCache) get(ctx context.Context, pid uint32, id int32) ([]location, error) {
+	key := stackKey{pid: pid, id: id}
+	c.mu.Lock()
+	if stack, ok := c.stacks.Get(key); ok {
+		c.mu.Unlock()
+		return stack, nil
+	}
+	// The reference keeps the stack id while it is loaded without the lock, and is passed on to the cached stack.
+	c.refs[id]++
+	c.mu.Unlock()
+
+	stack, err := c.load(ctx, pid, id)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.unref(id)
+		return nil, err
+	}
+	if cached, ok := c.stacks.Get(key); ok {
+		// Another goroutine loaded the same stack in the meantime.
+		c.unref(id)
+		return cached, nil
+	}
+	c.stacks.Add(key, stack)
+	return stack, nil
+}
+
+// unref drops a reference to the stack id and deletes the stack from stack_addresses when it is the last one.
+func (c *stackCache) unref(id int32) {
+	c.refs[id]--
+	if c.refs[id] > 0 {
+		return
+	}
+	delete(c.refs, id)
+	if err := c.release(id); err != nil {
+		slog.Debug("Failed to delete stack_addresses", slog.Int("stack_id", int(id)), slog.Any("error", err))
+	}
+}
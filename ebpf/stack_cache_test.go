@@ -0,0 +1,52 @@
+package ebpf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_stackCache(t *testing.T) {
+	var loaded []stackKey
+	var released []int32
+	c := newStackCache(2, func(_ context.Context, pid uint32, id int32) ([]location, error) {
+		if id < 0 {
+			return nil, errors.New("no stack")
+		}
+		loaded = append(loaded, stackKey{pid: pid, id: id})
+		return []location{{Function: fmt.Sprintf("pid %d", pid)}}, nil
+	}, func(id int32) error {
+		released = append(released, id)
+		return nil
+	})
+	ctx := context.Background()
+
+	// The same stack id is symbolized for each process.
+	stack, err := c.get(ctx, 100, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "pid 100", stack[0].Function)
+	stack, err = c.get(ctx, 200, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "pid 200", stack[0].Function)
+	_, err = c.get(ctx, 100, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []stackKey{{pid: 100, id: 1}, {pid: 200, id: 1}}, loaded)
+
+	// The stack id is kept while the other process has it in the cache.
+	_, err = c.get(ctx, 100, 2)
+	require.NoError(t, err)
+	assert.Empty(t, released, "pid 200 is evicted, but pid 100 still has the stack id 1")
+	_, err = c.get(ctx, 100, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []int32{1}, released)
+
+	// A stack that fails to load is released.
+	_, err = c.get(ctx, 100, -1)
+	assert.Error(t, err)
+	assert.Equal(t, []int32{1, -1}, released)
+	assert.NotContains(t, c.refs, int32(-1))
+}
@@ -0,0 +1,104 @@
+package ebpf
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// summaryTopSites is the number of creation sites listed in the summary.
+const summaryTopSites = 10
+
+// siteSummary is the number of goroutines created and exited at a creation site.
+type siteSummary struct {
+	stack   string
+	created float64
+	exited  float64
+}
+
+// WriteSummary writes the number of goroutines created and exited in the process,
+// and the creation sites that created the most goroutines.
+// The numbers are read from the metrics gathered from g, which remain after the process exits
+// if the process is a target and Options.RetainTargetMetrics is set.
+func WriteSummary(w io.Writer, g prometheus.Gatherer, pid int) error {
+	families, err := g.Gather()
+	if err != nil {
+		return err
+	}
+	sites := make(map[string]*siteSummary)
+	for _, family := range families {
+		var exit bool
+		switch family.GetName() {
+		case namespace + "_goroutine_creation":
+		case namespace + "_goroutine_exit":
+			exit = true
+		default:
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			stack, ok := summaryStack(m, pid)
+			if !ok {
+				continue
+			}
+			s, ok := sites[stack]
+			if !ok {
+				s = &siteSummary{stack: stack}
+				sites[stack] = s
+			}
+			if exit {
+				s.exited += m.GetCounter().GetValue()
+			} else {
+				s.created += m.GetCounter().GetValue()
+			}
+		}
+	}
+	summaries := make([]*siteSummary, 0, len(sites))
+	var created, exited float64
+	for _, s := range sites {
+		summaries = append(summaries, s)
+		created += s.created
+		exited += s.exited
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].created != summaries[j].created {
+			return summaries[i].created > summaries[j].created
+		}
+		return summaries[i].stack < summaries[j].stack
+	})
+	if len(summaries) > summaryTopSites {
+		summaries = summaries[:summaryTopSites]
+	}
+
+	fmt.Fprintf(w, "goroutines of pid %d: created %.0f, exited %.0f, alive at exit %.0f\n", pid, created, exited, created-exited)
+	if len(summaries) == 0 {
+		return nil
+	}
+	fmt.Fprintf(w, "%8s %8s  %s\n", "created", "exited", "creation site")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%8.0f %8.0f  %s\n", s.created, s.exited, s.stack)
+	}
+	return nil
+}
+
+// summaryStack returns the stack labels of the metric joined from the caller to the callee if the metric belongs to the process.
+func summaryStack(m *dto.Metric, pid int) (string, bool) {
+	labels := make(map[string]string, len(m.GetLabel()))
+	for _, l := range m.GetLabel() {
+		labels[l.GetName()] = l.GetValue()
+	}
+	if labels["pid"] != strconv.Itoa(pid) {
+		return "", false
+	}
+	var stack []string
+	for _, key := range stackLabelKeys {
+		if v := labels[key]; v != "" && v != "none" {
+			stack = append(stack, v)
+		}
+	}
+	return strings.Join(stack, " -> "), true
+}
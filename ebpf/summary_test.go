@@ -0,0 +1,39 @@
+package ebpf
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WriteSummary(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	r := &reporter{
+		metrics: newTestMetrics(t, Config{registerer: reg}),
+	}
+	worker := []location{{PC: 1, Function: "runtime.newproc"}, {PC: 2, Function: "main.startWorker"}, {PC: 3, Function: "main.main"}}
+	handler := []location{{PC: 1, Function: "runtime.newproc"}, {PC: 4, Function: "main.serve"}}
+	now := time.Now()
+	for _, g := range []goroutine{
+		{Id: 1, Pid: 100, ObservedAt: now, Stack: worker},
+		{Id: 2, Pid: 100, ObservedAt: now, Stack: worker},
+		{Id: 3, Pid: 100, ObservedAt: now, Stack: handler},
+		{Id: 3, Pid: 100, ObservedAt: now, Stack: handler, Exit: true},
+		{Id: 1, Pid: 200, ObservedAt: now, Stack: handler},
+	} {
+		r.storeGoroutine(context.Background(), g)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteSummary(&buf, reg, 100))
+	assert.Equal(t, `goroutines of pid 100: created 3, exited 1, alive at exit 2
+ created   exited  creation site
+       2        0  main.main -> main.startWorker -> runtime.newproc
+       1        1  main.serve -> runtime.newproc
+`, buf.String())
+}
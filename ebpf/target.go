@@ -0,0 +1,77 @@
+package ebpf
+
+import (
+	"debug/buildinfo"
+	"errors"
+	"fmt"
+
+	"github.com/keisku/gmon/bininfo"
+)
+
+// Target is an executable to be monitored.
+type Target struct {
+	binPath      string
+	goObjectPath string // binPath, or the Go shared object loaded by binPath
+	pid          int    // 0 to monitor all processes running binPath
+}
+
+func NewTarget(binPath, goObjectPath string, pid int) Target {
+	return Target{
+		binPath:      binPath,
+		goObjectPath: goObjectPath,
+		pid:          pid,
+	}
+}
+
+// ResolveTarget resolves the executable and the Go runtime to be monitored for the pid.
+// If path is empty, the executable of the pid is monitored. Otherwise, path is verified to be the executable of the pid.
+// If pid is 0, all processes running the executable at path are monitored.
+func ResolveTarget(path string, pid int) (Target, error) {
+	exePath, err := executablePath(path, pid)
+	if err != nil {
+		return Target{}, err
+	}
+	goObjectPath, err := bininfo.GoObject(exePath, pid)
+	if err != nil {
+		return Target{}, err
+	}
+	binfo, err := buildinfo.ReadFile(goObjectPath)
+	if err != nil {
+		return Target{}, err
+	}
+	if !isGoVersionSupported(binfo.GoVersion) {
+		return Target{}, fmt.Errorf("gmon requires Go 1.%d or higher, but %s is used for %s", bininfo.MinGoMinorVersion, binfo.GoVersion, binfo.Main.Path)
+	}
+	return NewTarget(exePath, goObjectPath, pid), nil
+}
+
+func executablePath(path string, pid int) (string, error) {
+	if pid == 0 {
+		if path == "" {
+			return "", errors.New("-path or -pid is required")
+		}
+		return path, nil
+	}
+	if path == "" {
+		return bininfo.Executable(pid)
+	}
+	if err := bininfo.VerifyExecutable(path, pid); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func isGoVersionSupported(v string) bool {
+	minor, ok := bininfo.GoMinorVersion(v)
+	if !ok {
+		return false
+	}
+	return bininfo.MinGoMinorVersion <= minor
+}
+
+func (t Target) String() string {
+	if t.binPath == t.goObjectPath {
+		return fmt.Sprintf("{binPath: %s, pid: %d}", t.binPath, t.pid)
+	}
+	return fmt.Sprintf("{binPath: %s, goObjectPath: %s, pid: %d}", t.binPath, t.goObjectPath, t.pid)
+}
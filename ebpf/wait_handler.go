@@ -0,0 +1,71 @@
+package ebpf
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/cilium/ebpf/ringbuf"
+)
+
+// waitHandler observes the time that goroutines were blocked by the wait reason and the creation site,
+// and the time that goroutines were blocked on channels.
+type waitHandler struct {
+	reader      *ringbuf.Reader
+	reporter    *reporter
+	attacher    *attacher
+	metrics     *metrics
+	waitReasons bool
+	channels    *channelAnalyzer // nil if channels are not analyzed
+}
+
+func newWaitHandler(reader *ringbuf.Reader, reporter *reporter, attacher *attacher, metrics *metrics, config Config, channels *channelAnalyzer) *waitHandler {
+	return &waitHandler{
+		reader:      reader,
+		reporter:    reporter,
+		attacher:    attacher,
+		metrics:     metrics,
+		waitReasons: config.waitReasons,
+		channels:    channels,
+	}
+}
+
+func (h *waitHandler) run(ctx context.Context) {
+	readEvents(h.reader, "wait", func(event bpfWaitEvent) {
+		h.observe(ctx, event)
+	})
+}
+
+func (h *waitHandler) observe(ctx context.Context, event bpfWaitEvent) {
+	duration := time.Duration(event.DurationNs)
+	if event.ChanOp != 0 && h.channels != nil {
+		h.channels.observe(ctx, event)
+	}
+	// The creation site of a goroutine that is not stored is unknown.
+	g, ok := h.reporter.goroutine(goroutineKey{pid: event.Pid, goid: event.GoroutineId})
+	if !ok {
+		return
+	}
+	if event.ChanOp != 0 && g.channelBlocked != nil {
+		g.channelBlocked.Add(int64(duration))
+	}
+	if !h.waitReasons {
+		return
+	}
+	labels := h.metrics.goroutineLabels(g)
+	labels["wait_reason"] = h.reason(event.Pid, event.Reason)
+	h.metrics.goroutineWait.With(labels).Observe(duration.Seconds())
+}
+
+// reason returns the string of the wait reason in the process, or the number if the string is unknown.
+func (h *waitHandler) reason(pid uint32, reason uint8) string {
+	object, path, ok := h.attacher.goObject(int(pid))
+	if !ok {
+		return strconv.Itoa(int(reason))
+	}
+	reasons := object.waitReasons(int(pid), path)
+	if int(reason) < len(reasons) && reasons[reason] != "" {
+		return reasons[reason]
+	}
+	return strconv.Itoa(int(reason))
+}
@@ -0,0 +1,81 @@
+package ebpf
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_waitHandler_observe(t *testing.T) {
+	config := Config{waitReasons: true, waitBuckets: []float64{0.1, 1}}
+	metrics := newTestMetrics(t, config)
+	r := &reporter{metrics: metrics}
+	r.storeGoroutine(context.Background(), goroutine{Id: 1, Pid: 100, ObservedAt: time.Now()})
+	r.storeGoroutine(context.Background(), goroutine{Id: 1, Pid: 200, ObservedAt: time.Now()})
+	serverID := testFileID(t)
+	a := newAttacher(config)
+	a.attachments[Target{pid: 100, goObjectPath: "/usr/bin/server"}] = attachment{object: serverID}
+	a.objects[serverID] = &goObject{
+		targets:     1,
+		reasons:     []string{"", "GC assist marking", "IO wait", "chan receive"},
+		reasonsRead: true,
+	}
+	h := newWaitHandler(nil, r, a, metrics, config, nil)
+
+	for _, event := range []bpfWaitEvent{
+		{GoroutineId: 1, Pid: 100, Reason: 3, DurationNs: uint64(500 * time.Millisecond)},
+		{GoroutineId: 1, Pid: 100, Reason: 3, DurationNs: uint64(2 * time.Second)},
+		// The string of the reason is unknown.
+		{GoroutineId: 1, Pid: 200, Reason: 2, DurationNs: uint64(time.Millisecond)},
+		// The goroutine is unknown.
+		{GoroutineId: 2, Pid: 100, Reason: 3, DurationNs: uint64(time.Millisecond)},
+	} {
+		h.observe(context.Background(), event)
+	}
+
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.goroutineWait))
+	want := `
+# HELP gmon_goroutine_wait_seconds Time in seconds that goroutines were blocked until they became runnable, by wait reason
+# TYPE gmon_goroutine_wait_seconds histogram
+gmon_goroutine_wait_seconds_bucket{pid="100",stack_0="none",stack_1="none",stack_2="none",stack_3="none",stack_4="none",wait_reason="chan receive",le="0.1"} 0
+gmon_goroutine_wait_seconds_bucket{pid="100",stack_0="none",stack_1="none",stack_2="none",stack_3="none",stack_4="none",wait_reason="chan receive",le="1"} 1
+gmon_goroutine_wait_seconds_bucket{pid="100",stack_0="none",stack_1="none",stack_2="none",stack_3="none",stack_4="none",wait_reason="chan receive",le="+Inf"} 2
+gmon_goroutine_wait_seconds_sum{pid="100",stack_0="none",stack_1="none",stack_2="none",stack_3="none",stack_4="none",wait_reason="chan receive"} 2.5
+gmon_goroutine_wait_seconds_count{pid="100",stack_0="none",stack_1="none",stack_2="none",stack_3="none",stack_4="none",wait_reason="chan receive"} 2
+gmon_goroutine_wait_seconds_bucket{pid="200",stack_0="none",stack_1="none",stack_2="none",stack_3="none",stack_4="none",wait_reason="2",le="0.1"} 1
+gmon_goroutine_wait_seconds_bucket{pid="200",stack_0="none",stack_1="none",stack_2="none",stack_3="none",stack_4="none",wait_reason="2",le="1"} 1
+gmon_goroutine_wait_seconds_bucket{pid="200",stack_0="none",stack_1="none",stack_2="none",stack_3="none",stack_4="none",wait_reason="2",le="+Inf"} 1
+gmon_goroutine_wait_seconds_sum{pid="200",stack_0="none",stack_1="none",stack_2="none",stack_3="none",stack_4="none",wait_reason="2"} 0.001
+gmon_goroutine_wait_seconds_count{pid="200",stack_0="none",stack_1="none",stack_2="none",stack_3="none",stack_4="none",wait_reason="2"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(metrics.goroutineWait, strings.NewReader(want)))
+}
+
+func Test_waitHandler_observe_channel(t *testing.T) {
+	config := Config{channels: true}
+	metrics := newTestMetrics(t, config)
+	r := &reporter{metrics: metrics}
+	r.storeGoroutine(context.Background(), goroutine{Id: 1, Pid: 100, ObservedAt: time.Now()})
+	h := newWaitHandler(nil, r, newAttacher(config), metrics, config, nil)
+
+	for _, event := range []bpfWaitEvent{
+		{GoroutineId: 1, Pid: 100, Reason: 3, ChanOp: 2, Chan: 0xc000010000, DurationNs: uint64(time.Second)},
+		// The select has not been resolved to a channel.
+		{GoroutineId: 1, Pid: 100, Reason: 9, ChanOp: 3, DurationNs: uint64(2 * time.Second)},
+		// The goroutine was not blocked on a channel.
+		{GoroutineId: 1, Pid: 100, Reason: 2, DurationNs: uint64(4 * time.Second)},
+	} {
+		h.observe(context.Background(), event)
+	}
+
+	g, ok := r.goroutine(goroutineKey{pid: 100, goid: 1})
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, time.Duration(g.channelBlocked.Load()))
+	assert.Equal(t, 3.0, newGoroutineView(g).ChannelBlockedSeconds)
+	// The wait reasons are not observed without -wait-reasons.
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.goroutineWait))
+}
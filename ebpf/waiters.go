@@ -0,0 +1,54 @@
+package ebpf
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// waiterSite is the time that goroutines were blocked by the same operation at the same stack.
+type waiterSite struct {
+	Op             string          `json:"op"`
+	Stack          []*locationView `json:"stack"`
+	BlockedSeconds float64         `json:"blocked_seconds"`
+	Waits          int             `json:"waits"`
+	blocked        time.Duration
+}
+
+// waiterSites groups blocked goroutines by the operation and the stack.
+type waiterSites map[string]*waiterSite
+
+func (s waiterSites) add(op string, stack []location, blocked time.Duration) {
+	names := make([]string, len(stack))
+	for i, l := range stack {
+		names[i] = l.String()
+	}
+	key := op + ";" + strings.Join(names, ";")
+	w, ok := s[key]
+	if !ok {
+		w = &waiterSite{Op: op, Stack: newStackView(stack)}
+		s[key] = w
+	}
+	w.blocked += blocked
+	w.Waits++
+}
+
+// sorted returns the copies of the sites, the longest blocked first, and then the most frequent first.
+func (s waiterSites) sorted() []*waiterSite {
+	sites := make([]*waiterSite, 0, len(s))
+	for _, w := range s {
+		site := *w
+		site.BlockedSeconds = w.blocked.Seconds()
+		sites = append(sites, &site)
+	}
+	sort.Slice(sites, func(i, j int) bool {
+		if sites[i].blocked != sites[j].blocked {
+			return sites[i].blocked > sites[j].blocked
+		}
+		if sites[i].Waits != sites[j].Waits {
+			return sites[i].Waits > sites[j].Waits
+		}
+		return sites[i].Op < sites[j].Op
+	})
+	return sites
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"bufio"
 	"context"
-	"debug/buildinfo"
 	"errors"
 	"flag"
 	"fmt"
@@ -13,17 +12,21 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/exec"
 	"os/signal"
+	"regexp"
 	"runtime"
 	"runtime/debug"
 	"runtime/trace"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cilium/ebpf/rlimit"
 	"github.com/keisku/gmon/ebpf"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/procfs"
 )
 
 var (
@@ -43,17 +46,91 @@ var (
 		"ERROR": slog.LevelError,
 		"error": slog.LevelError,
 	}
-	pid          = flag.Int("pid", 0, "Useful when tracing programs that have many running instances")
-	binPath      = flag.String("path", "", "Path to executable file to be monitored (required)")
-	traceOutPath = flag.String("trace", "", "Path to Go runtime/trace output")
-	pprofPort    = flag.Int("pprof", 0, "Port to be used for pprof server. If 0, pprof server is not started")
-	metricsPort  = flag.Int("metrics", 5500, "Port to be used for metrics server, /metrics endpoint")
-	printVersion = flag.Bool("version", false, "Print version information")
+	pid             = flag.Int("pid", 0, "Useful when tracing programs that have many running instances. Required to find a Go shared object loaded by a non-Go executable")
+	binPath         = flag.String("path", "", "Path to executable file to be monitored. If empty, the executable of -pid is monitored")
+	processName     = flag.String("name", "", "Monitor the Go processes whose command name is this. Cannot be used with -path or -pid")
+	cmdlineRegex    = flag.String("cmdline-regex", "", "Monitor the Go processes whose command line matches this regular expression. Cannot be used with -path or -pid")
+	daemon          = flag.Bool("daemon", false, "Monitor every Go process on the host, including the ones that start later. Cannot be used with -path, -pid, -name or -cmdline-regex")
+	followChildren  = flag.Bool("follow-children", false, "Also monitor the Go processes that the monitored processes spawn. Their metrics have the ppid label of the parent process. Requires the pid of the monitored processes")
+	traceOutPath    = flag.String("trace", "", "Path to Go runtime/trace output")
+	pprofPort       = flag.Int("pprof", 0, "Port to be used for pprof server. If 0, pprof server is not started")
+	metricsPort     = flag.Int("metrics", 5500, "Port to be used for metrics server, /metrics endpoint")
+	printVersion    = flag.Bool("version", false, "Print version information")
+	leakAge         = flag.Duration("leak-age", 10*time.Minute, "Suspect a goroutine leak when a goroutine lives longer than this. If 0, the age check is disabled")
+	leakSiteAge     = siteDurations{}
+	leakWindow      = flag.Duration("leak-growth-window", 5*time.Minute, "Suspect a goroutine leak when the live goroutines of a creation site keep growing over this window. If 0, the growth check is disabled")
+	reconcile       = flag.Duration("reconcile-interval", time.Minute, "Interval to evict goroutines that are not live in the processes anymore, e.g. due to lost exit events. If 0, the reconciliation is disabled")
+	siteLabels      = flag.Bool("site-labels", false, "Add the created_by and start_function labels to metrics. Useful to tell closures apart, but increases cardinality")
+	stackLabelMode  = flag.String("stack-label-mode", ebpf.StackLabelModeFunction, fmt.Sprintf("Value of the stack_* labels of metrics, %q or %q. %q adds file and line numbers, but increases cardinality", ebpf.StackLabelModeFunction, ebpf.StackLabelModeLocation, ebpf.StackLabelModeLocation))
+	lifetimeBuckets = buckets{1, 3, 5, 10, 30, 60, 120, 180}
+	ageBuckets      = buckets{1, 3, 5, 10, 30, 60, 120, 180, 600, 1800, 3600}
+	waitReasons     = flag.Bool("wait-reasons", false, "Observe how long goroutines are blocked by wait reason, such as channels, select, mutexes, IO and sleep. Adds overhead to every goroutine switch of the monitored processes")
+	waitBuckets     = buckets{0.0001, 0.001, 0.01, 0.1, 1, 10, 60, 600}
+	locks           = flag.Bool("locks", false, "Measure how long goroutines wait for contended sync.Mutex and sync.RWMutex by lock and call site, served at /locks. Adds overhead to the contended locks of the monitored processes")
+	schedLatency    = flag.Bool("sched-latency", false, "Observe how long goroutines are runnable until they get a P, e.g. due to GOMAXPROCS starvation. The slowest goroutines are served at /goroutines/sched. Adds overhead to every goroutine switch of the monitored processes")
+	schedBuckets    = buckets{0.00001, 0.0001, 0.001, 0.01, 0.1, 1}
+	channels        = flag.Bool("channels", false, "Analyze the channels that goroutines are blocked on the longest, served at /channels. Adds overhead to every channel operation of the monitored processes")
 
 	// Set by -ldflags at build time
 	Version = "unknown"
 )
 
+func init() {
+	flag.Var(&lifetimeBuckets, "lifetime-buckets", "Comma-separated histogram buckets in seconds for the lifetime of exited goroutines")
+	flag.Var(&ageBuckets, "age-buckets", "Comma-separated buckets in seconds for the age of live goroutines")
+	flag.Var(&waitBuckets, "wait-buckets", "Comma-separated histogram buckets in seconds for the time goroutines are blocked. Used with -wait-reasons and -locks")
+	flag.Var(&schedBuckets, "sched-buckets", "Comma-separated histogram buckets in seconds for the time goroutines are runnable until they get a P. Used with -sched-latency")
+	flag.Var(leakSiteAge, "leak-age-site", "Override -leak-age for goroutines whose creation stack has the function, in the form of function=duration. Can be repeated")
+}
+
+// siteDurations is a flag.Value that collects function=duration pairs.
+type siteDurations map[string]time.Duration
+
+func (s siteDurations) String() string {
+	pairs := make([]string, 0, len(s))
+	for site, d := range s {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", site, d))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (s siteDurations) Set(v string) error {
+	i := strings.LastIndex(v, "=")
+	if i <= 0 {
+		return fmt.Errorf("%q is not in the form of function=duration", v)
+	}
+	d, err := time.ParseDuration(v[i+1:])
+	if err != nil {
+		return err
+	}
+	s[v[:i]] = d
+	return nil
+}
+
+// buckets is a flag.Value that parses comma-separated histogram buckets.
+type buckets []float64
+
+func (b *buckets) String() string {
+	values := make([]string, len(*b))
+	for i, v := range *b {
+		values[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return strings.Join(values, ",")
+}
+
+func (b *buckets) Set(v string) error {
+	var parsed buckets
+	for _, s := range strings.Split(v, ",") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, f)
+	}
+	*b = parsed
+	return nil
+}
+
 type promLogger struct{}
 
 func (promLogger) Println(v ...interface{}) {
@@ -61,7 +138,13 @@ func (promLogger) Println(v ...interface{}) {
 }
 
 func main() {
-	flag.Parse()
+	// gmon run [flags] -- command [args...] runs the command under gmon.
+	runMode := 1 < len(os.Args) && os.Args[1] == "run"
+	if runMode {
+		_ = flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
 	if *printVersion {
 		var gover, arch, goos, commitHash = "unknown", "unknown", "unknown", "unknown"
 		if info, ok := debug.ReadBuildInfo(); ok {
@@ -89,50 +172,116 @@ func main() {
 		errlog.Fatalln("gmon only works on amd64 Linux")
 	}
 
-	binfo, err := buildinfo.ReadFile(*binPath)
-	if err != nil {
-		errlog.Fatalln(err)
+	var targets []ebpf.Target
+	var cmd *exec.Cmd
+	var err error
+	if runMode {
+		if *binPath != "" || *pid != 0 || *processName != "" || *cmdlineRegex != "" || *daemon {
+			errlog.Fatalln("gmon run cannot be used with -path, -pid, -name, -cmdline-regex or -daemon")
+		}
+		if flag.NArg() == 0 {
+			errlog.Fatalln("gmon run requires a command: gmon run [flags] -- command [args...]")
+		}
+		cmd, err = startCommand(flag.Args())
+		if err != nil {
+			errlog.Fatalln(err)
+		}
+		var target ebpf.Target
+		target, err = ebpf.ResolveTarget("", cmd.Process.Pid)
+		targets = []ebpf.Target{target}
+	} else if *daemon {
+		if *binPath != "" || *pid != 0 || *processName != "" || *cmdlineRegex != "" {
+			errlog.Fatalln("-daemon cannot be used with -path, -pid, -name or -cmdline-regex")
+		}
+		targets, err = scanTargets("", nil)
+	} else if *processName != "" || *cmdlineRegex != "" {
+		if *binPath != "" || *pid != 0 {
+			errlog.Fatalln("-name and -cmdline-regex cannot be used with -path or -pid")
+		}
+		var re *regexp.Regexp
+		if *cmdlineRegex != "" {
+			re, err = regexp.Compile(*cmdlineRegex)
+			if err != nil {
+				errlog.Fatalln(err)
+			}
+		}
+		targets, err = selectTargets(*processName, re)
+	} else {
+		var target ebpf.Target
+		target, err = ebpf.ResolveTarget(*binPath, *pid)
+		targets = []ebpf.Target{target}
 	}
-	if !isGoVersion123OrHigher(binfo.GoVersion) {
-		errlog.Fatalf("gmon requires Go 1.23 or higher, but %s is used for %s", binfo.GoVersion, binfo.Main.Path)
+	// The command must not be left stopped if gmon fails to start.
+	fatal := func(v ...any) {
+		if cmd != nil {
+			killCommand(cmd)
+		}
+		errlog.Fatalln(v...)
+	}
+	if err != nil {
+		fatal(err)
 	}
 
 	if *traceOutPath != "" {
 		traceOutFile, err := os.Create(*traceOutPath)
 		if err != nil {
-			errlog.Fatalln(err)
+			fatal(err)
 		}
 		if err := trace.Start(traceOutFile); err != nil {
-			errlog.Fatalln(err)
+			fatal(err)
 		}
 	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	ctx, cancel := context.WithCancel(context.Background())
+	if !runMode {
+		// In the run mode, signals are forwarded to the command, and gmon exits when the command exits.
+		ctx, cancel = signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	}
 	defer cancel()
 
 	if err := rlimit.RemoveMemlock(); err != nil {
-		errlog.Fatalln(err)
+		fatal(err)
 	}
 
-	http.Handle("/metrics", promhttp.HandlerFor(
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(
 		prometheus.DefaultGatherer,
 		promhttp.HandlerOpts{
 			ErrorLog:          promLogger{},
 			EnableOpenMetrics: true,
 		},
 	))
-	go http.ListenAndServe(fmt.Sprintf(":%d", *metricsPort), nil)
+	go http.ListenAndServe(fmt.Sprintf(":%d", *metricsPort), mux)
 
-	ebpfConfig, err := ebpf.NewConfig(
-		*binPath,
-		*pid,
-	)
+	ebpfConfig, err := ebpf.NewConfig(ebpf.Options{
+		Targets:           targets,
+		Daemon:            *daemon,
+		FollowChildren:    *followChildren,
+		LeakMaxAge:        *leakAge,
+		LeakSiteMaxAge:    leakSiteAge,
+		LeakGrowthWindow:  *leakWindow,
+		ReconcileInterval: *reconcile,
+		LifetimeBuckets:   lifetimeBuckets,
+		AgeBuckets:        ageBuckets,
+		SiteLabels:        *siteLabels,
+		StackLabelMode:    *stackLabelMode,
+		WaitReasons:       *waitReasons,
+		WaitBuckets:       waitBuckets,
+		Channels:          *channels,
+		Locks:             *locks,
+		SchedLatency:      *schedLatency,
+		SchedBuckets:      schedBuckets,
+		// The summary is written after the command exits.
+		RetainTargetMetrics: runMode,
+		Mux:                 mux,
+		Registerer:          prometheus.DefaultRegisterer,
+	})
 	if err != nil {
-		errlog.Fatalln(err)
+		fatal(err)
 	}
 	eBPFClose, err := ebpf.Run(ctx, ebpfConfig)
 	if err != nil {
-		errlog.Fatalln(err)
+		fatal(err)
 	}
 	if levelMap[*level] == slog.LevelDebug {
 		go logTracePipe(ctx.Done())
@@ -142,6 +291,19 @@ func main() {
 			_ = http.ListenAndServe(fmt.Sprintf("127.0.0.1:%d", pprofPort), nil)
 		}()
 	}
+	if runMode {
+		if err := resumeCommand(cmd); err != nil {
+			fatal(err)
+		}
+		code := waitCommand(cmd)
+		time.Sleep(summaryDelay)
+		if err := ebpf.WriteSummary(os.Stderr, prometheus.DefaultGatherer, cmd.Process.Pid); err != nil {
+			slog.Warn("Failed to write the summary", slog.Any("error", err))
+		}
+		eBPFClose()
+		cancel()
+		os.Exit(code)
+	}
 	<-ctx.Done()
 	slog.Debug("gmon exits")
 	eBPFClose()
@@ -172,20 +334,58 @@ func logTracePipe(done <-chan struct{}) {
 	<-done
 }
 
-func isGoVersion123OrHigher(v string) bool {
-	versionSplit := strings.Split(v, ".")
-	if len(versionSplit) != 3 {
-		return false
+// selectTargets scans /proc for the Go processes whose command name is name or whose command line matches re.
+// It fails if no processes match.
+func selectTargets(name string, re *regexp.Regexp) ([]ebpf.Target, error) {
+	targets, err := scanTargets(name, re)
+	if err != nil {
+		return nil, err
 	}
-	if versionSplit[0] != "go1" {
-		return false
+	if len(targets) == 0 {
+		return nil, errors.New("no Go processes match -name or -cmdline-regex")
 	}
-	minor, err := strconv.Atoi(versionSplit[1])
+	return targets, nil
+}
+
+// scanTargets scans /proc for the Go processes whose command name is name or whose command line matches re.
+// All Go processes match if no selectors are given.
+// Processes that cannot be monitored, such as non-Go processes, are skipped.
+func scanTargets(name string, re *regexp.Regexp) ([]ebpf.Target, error) {
+	procs, err := procfs.AllProcs()
 	if err != nil {
-		return false
+		return nil, err
 	}
-	if minor < 23 {
-		return false
+	self := os.Getpid()
+	var targets []ebpf.Target
+	for _, p := range procs {
+		if p.PID == self || !matchProcess(p, name, re) {
+			continue
+		}
+		target, err := ebpf.ResolveTarget("", p.PID)
+		if err != nil {
+			slog.Debug("skip the process", slog.Int("pid", p.PID), slog.Any("error", err))
+			continue
+		}
+		slog.Info("monitor the process", slog.Int("pid", p.PID), slog.String("target", target.String()))
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// matchProcess reports whether the process matches all the given selectors.
+func matchProcess(p procfs.Proc, name string, re *regexp.Regexp) bool {
+	if name != "" {
+		comm, err := p.Comm()
+		if err != nil || comm != name {
+			return false
+		}
+	}
+	if re != nil {
+		cmdline, err := p.CmdLine()
+		// Kernel threads have no command line.
+		if err != nil || len(cmdline) == 0 || !re.MatchString(strings.Join(cmdline, " ")) {
+			return false
+		}
 	}
 	return true
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/keisku/gmon/ebpf"
+	"github.com/prometheus/procfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_matchProcess(t *testing.T) {
+	self, err := procfs.Self()
+	require.NoError(t, err)
+	comm, err := self.Comm()
+	require.NoError(t, err)
+	// A kernel thread has a command name but no command line.
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "2"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "2", "comm"), []byte("kthreadd\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "2", "cmdline"), nil, 0o644))
+	fs, err := procfs.NewFS(root)
+	require.NoError(t, err)
+	kthread, err := fs.Proc(2)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		proc procfs.Proc
+		comm string
+		re   *regexp.Regexp
+		want bool
+	}{
+		{name: "no selectors", proc: self, want: true},
+		{name: "name matches", proc: self, comm: comm, want: true},
+		{name: "name does not match", proc: self, comm: comm + "x", want: false},
+		{name: "regex matches", proc: self, re: regexp.MustCompile(`-test\.`), want: true},
+		{name: "regex does not match", proc: self, re: regexp.MustCompile(`^no-such-command$`), want: false},
+		{name: "both match", proc: self, comm: comm, re: regexp.MustCompile(`-test\.`), want: true},
+		{name: "name matches but regex does not", proc: self, comm: comm, re: regexp.MustCompile(`^no-such-command$`), want: false},
+		{name: "regex matches but name does not", proc: self, comm: comm + "x", re: regexp.MustCompile(`-test\.`), want: false},
+		{name: "kernel thread matches name", proc: kthread, comm: "kthreadd", want: true},
+		{name: "kernel thread never matches regex", proc: kthread, re: regexp.MustCompile(`.*`), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchProcess(tt.proc, tt.comm, tt.re))
+		})
+	}
+}
+
+func Test_scanTargets(t *testing.T) {
+	if os.Getenv("GMON_TEST_SCAN_TARGET") != "" {
+		// The child process to be found by the parent test.
+		time.Sleep(time.Minute)
+		return
+	}
+	executable, err := os.Executable()
+	require.NoError(t, err)
+	cmd := exec.Command(executable, "-test.run=^Test_scanTargets$")
+	cmd.Env = append(os.Environ(), "GMON_TEST_SCAN_TARGET=1")
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	want, err := ebpf.ResolveTarget("", cmd.Process.Pid)
+	require.NoError(t, err)
+	self, err := procfs.Self()
+	require.NoError(t, err)
+	comm, err := self.Comm()
+	require.NoError(t, err)
+
+	// The test process has the same name, but gmon never monitors itself.
+	// The command line of the child may be empty for a moment after Start returns, until the kernel sets up its arguments.
+	var targets []ebpf.Target
+	require.Eventually(t, func() bool {
+		targets, err = scanTargets(comm, regexp.MustCompile(`-test\.run=\^Test_scanTargets\$`))
+		return err == nil && len(targets) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []ebpf.Target{want}, targets)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// summaryDelay is the time to wait for the remaining events of the command to be processed before the summary is printed.
+const summaryDelay = time.Second
+
+// forwardedSignals are the signals that gmon forwards to the command.
+var forwardedSignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGTERM,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+// terminalSignals are the signals that the terminal sends to its foreground process group on keystrokes.
+// The command is in the process group of gmon, so it receives them without forwarding if gmon is in the foreground.
+var terminalSignals = map[os.Signal]bool{
+	syscall.SIGINT:  true,
+	syscall.SIGQUIT: true,
+}
+
+// startCommand starts the command stopped right after exec with ptrace,
+// so that uprobes are attached before the command creates the first goroutine.
+// The calling goroutine stays locked to the OS thread until resumeCommand
+// since ptrace requests must come from the thread that started the command.
+func startCommand(args []string) (*exec.Cmd, error) {
+	runtime.LockOSThread()
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// The command stays in the process group of gmon, so that it can read from the terminal
+	// and job control stops and continues both of them.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Ptrace: true}
+	if err := cmd.Start(); err != nil {
+		runtime.UnlockOSThread()
+		return nil, err
+	}
+	var ws syscall.WaitStatus
+	if _, err := syscall.Wait4(cmd.Process.Pid, &ws, 0, nil); err != nil {
+		killCommand(cmd)
+		return nil, fmt.Errorf("failed to wait for %s to exec: %w", args[0], err)
+	}
+	if !ws.Stopped() {
+		killCommand(cmd)
+		return nil, fmt.Errorf("%s is not stopped after exec", args[0])
+	}
+	return cmd, nil
+}
+
+// resumeCommand resumes the command stopped by startCommand.
+func resumeCommand(cmd *exec.Cmd) error {
+	defer runtime.UnlockOSThread()
+	return syscall.PtraceDetach(cmd.Process.Pid)
+}
+
+// killCommand kills the command started by startCommand.
+func killCommand(cmd *exec.Cmd) {
+	defer runtime.UnlockOSThread()
+	if err := cmd.Process.Kill(); err != nil {
+		slog.Warn("Failed to kill the command", slog.Any("error", err))
+	}
+	_ = cmd.Wait()
+}
+
+// waitCommand forwards signals to the command until it exits, and returns the exit code of the command.
+// The signals from the terminal are not forwarded if gmon is in the foreground, since the command has received them.
+func waitCommand(cmd *exec.Cmd) int {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if terminalSignals[sig] && inForeground() {
+					continue
+				}
+				if err := cmd.Process.Signal(sig); err != nil {
+					slog.Debug("failed to forward the signal", slog.String("signal", sig.String()), slog.Any("error", err))
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	_ = cmd.Wait()
+	close(done)
+	// Follow the convention of shells for commands killed by a signal.
+	if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return cmd.ProcessState.ExitCode()
+}
+
+// inForeground reports whether gmon is in the foreground process group of the terminal.
+func inForeground() bool {
+	pgrp, err := unix.IoctlGetInt(int(os.Stdin.Fd()), unix.TIOCGPGRP)
+	return err == nil && pgrp == unix.Getpgrp()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_waitCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   int
+	}{
+		{name: "success", script: "exit 0", want: 0},
+		{name: "failure", script: "exit 3", want: 3},
+		{name: "killed by SIGTERM", script: "kill -TERM $$", want: 128 + int(syscall.SIGTERM)},
+		{name: "killed by SIGKILL", script: "kill -KILL $$", want: 128 + int(syscall.SIGKILL)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command("sh", "-c", tt.script)
+			require.NoError(t, cmd.Start())
+			assert.Equal(t, tt.want, waitCommand(cmd))
+		})
+	}
+}
+
+func Test_waitCommand_forward(t *testing.T) {
+	// The signal must not terminate the test before waitCommand starts to forward it.
+	ignored := make(chan os.Signal, 1)
+	signal.Notify(ignored, syscall.SIGTERM)
+	defer signal.Stop(ignored)
+
+	cmd := exec.Command("sleep", "60")
+	require.NoError(t, cmd.Start())
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	// The sender must stop before signal.Stop, or a late signal terminates the test.
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Send the signal until it is forwarded since waitCommand may not have started yet.
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(100 * time.Millisecond):
+				_ = syscall.Kill(os.Getpid(), syscall.SIGTERM)
+			}
+		}
+	}()
+	assert.Equal(t, 128+int(syscall.SIGTERM), waitCommand(cmd))
+}